@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/allbuleyu/blog/framework"
+)
+
+// runAssets 计算静态目录中文件的哈希, 把清单写到 -o 指定的文件. 服务启动时加载清单并校验, 文件改过之后要重新生成
+func runAssets(args []string) error {
+	fs := flag.NewFlagSet("assets", flag.ExitOnError)
+	dir := fs.String("dir", "public", "static directory")
+	prefix := fs.String("prefix", "/public", "URL prefix the directory is served under")
+	out := fs.String("o", "assets.json", "manifest file")
+	fs.Parse(args)
+
+	m, err := framework.BuildAssetManifest(os.DirFS(*dir), *prefix)
+	if err != nil {
+		return err
+	}
+	if err := m.Save(*out); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d assets written to %s\n", len(m.Assets), *out)
+	return nil
+}
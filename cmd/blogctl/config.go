@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/allbuleyu/blog/framework"
+)
+
+var configCommands = []command{
+	{"keygen", "generate a secret key", runConfigKeygen},
+	{"encrypt", "encrypt the values of keys in place", runConfigEncrypt},
+	{"decrypt", "print the decrypted values of keys, or write them back with -w", runConfigDecrypt},
+	{"rotate", "re-encrypt all encrypted values with a new secret key", runConfigRotate},
+}
+
+// runConfig 管理配置文件中加密的值, 密钥来自 -key-file 或者 BLOG_SECRET_KEY, BLOG_SECRET_KEY_FILE
+func runConfig(args []string) error {
+	if len(args) > 0 {
+		for _, c := range configCommands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "usage: blogctl config <command> [flags]\n\ncommands:")
+	for _, c := range configCommands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	return errors.New("missing or unknown command")
+}
+
+// runConfigKeygen 生成新的密钥, 打印出来或者写到 -o 指定的文件
+func runConfigKeygen(args []string) error {
+	fs := flag.NewFlagSet("config keygen", flag.ExitOnError)
+	out := fs.String("o", "", "write the key to this file instead of stdout")
+	fs.Parse(args)
+
+	key, err := framework.NewSecretKey()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Println(key)
+		return nil
+	}
+	return os.WriteFile(*out, []byte(key+"\n"), 0600)
+}
+
+func runConfigEncrypt(args []string) error {
+	fs := flag.NewFlagSet("config encrypt", flag.ExitOnError)
+	file := fs.String("f", "conf/app.conf", "config file")
+	keyFile := fs.String("key-file", "", "secret key file, instead of "+framework.SecretKeyEnv)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("no keys to encrypt")
+	}
+	cfg, secret, err := loadSecretConfig(*file, *keyFile)
+	if err != nil {
+		return err
+	}
+	for _, key := range fs.Args() {
+		if err := cfg.Encrypt(key, secret); err != nil {
+			return err
+		}
+	}
+	if err := cfg.SaveConfigFile(*file); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d keys encrypted in %s\n", fs.NArg(), *file)
+	return nil
+}
+
+func runConfigDecrypt(args []string) error {
+	fs := flag.NewFlagSet("config decrypt", flag.ExitOnError)
+	file := fs.String("f", "conf/app.conf", "config file")
+	keyFile := fs.String("key-file", "", "secret key file, instead of "+framework.SecretKeyEnv)
+	write := fs.Bool("w", false, "write the plaintext values back to the file")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("no keys to decrypt")
+	}
+	cfg, secret, err := loadSecretConfig(*file, *keyFile)
+	if err != nil {
+		return err
+	}
+
+	if !*write {
+		for _, key := range fs.Args() {
+			value, err := cfg.Secret(key)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s = %s\n", key, value)
+		}
+		return nil
+	}
+
+	for _, key := range fs.Args() {
+		if err := cfg.Decrypt(key, secret); err != nil {
+			return err
+		}
+	}
+	if err := cfg.SaveConfigFile(*file); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d keys decrypted in %s\n", fs.NArg(), *file)
+	return nil
+}
+
+// runConfigRotate 用旧的密钥解密所有加密的值, 再用 -new-key-file 中的密钥加密
+func runConfigRotate(args []string) error {
+	fs := flag.NewFlagSet("config rotate", flag.ExitOnError)
+	file := fs.String("f", "conf/app.conf", "config file")
+	keyFile := fs.String("key-file", "", "current secret key file, instead of "+framework.SecretKeyEnv)
+	newKeyFile := fs.String("new-key-file", "", "new secret key file, see \"blogctl config keygen\"")
+	fs.Parse(args)
+
+	if *newKeyFile == "" {
+		return errors.New("-new-key-file is required")
+	}
+	newKey, err := readSecretKey(*newKeyFile)
+	if err != nil {
+		return err
+	}
+	cfg, secret, err := loadSecretConfig(*file, *keyFile)
+	if err != nil {
+		return err
+	}
+
+	n, err := cfg.RotateSecrets(secret, newKey)
+	if err != nil {
+		return err
+	}
+	if err := cfg.SaveConfigFile(*file); err != nil {
+		return err
+	}
+
+	fmt.Printf("%d values re-encrypted in %s\n", n, *file)
+	return nil
+}
+
+// loadSecretConfig 读取配置文件和密钥, keyFile 为空时从环境变量读取密钥
+func loadSecretConfig(file, keyFile string) (*framework.Config, []byte, error) {
+	var secret []byte
+	var err error
+	if keyFile != "" {
+		secret, err = readSecretKey(keyFile)
+	} else {
+		secret, err = framework.LoadSecretKey()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := framework.LoadConfig(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.SetSecretKey(secret)
+	return cfg, secret, nil
+}
+
+func readSecretKey(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return framework.ParseSecretKey(string(b))
+}
@@ -0,0 +1,59 @@
+// blogctl 是博客的命令行工具
+//
+//	blogctl assets [-dir public] [-prefix /public] [-o assets.json]       生成静态文件清单
+//	blogctl config keygen [-o conf/master.key]                            生成加密配置用的密钥
+//	blogctl config encrypt [-f conf/app.conf] [-key-file f] key...        加密配置中的值
+//	blogctl config decrypt [-f conf/app.conf] [-key-file f] [-w] key...   打印或者写回解密的值
+//	blogctl config rotate [-f conf/app.conf] -new-key-file f              用新的密钥重新加密
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"assets", "generate the fingerprinted asset manifest", runAssets},
+	{"config", "encrypt, decrypt and rotate secrets in config files", runConfig},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: blogctl <command> [flags]\n\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun \"blogctl <command> -h\" for the flags of a command")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "blogctl "+name+":", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "blogctl: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
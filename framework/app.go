@@ -0,0 +1,202 @@
+// 应用
+// App 持有路由, 配置和会话管理器, 负责启动和优雅地关闭 HTTP 服务:
+//
+//	app := NewApp(cfg)
+//	app.Router.Add("/", &MainController{})
+//	log.Fatal(app.Run())
+//
+// 配置项 (都有默认值):
+//
+//	addr                 监听地址, 默认 :8080
+//	read_timeout         读取整个请求的超时, 默认 30s
+//	read_header_timeout  读取请求头的超时, 默认 10s
+//	write_timeout        写响应的超时, 默认 30s
+//	idle_timeout         keep-alive 连接的空闲超时, 默认 120s
+//	shutdown_timeout     收到信号之后等待请求处理完的时间, 默认 10s
+//	tls_cert, tls_key    证书和私钥文件, 设置之后使用 HTTPS
+//	http2                HTTPS 时是否启用 HTTP/2, 默认 true
+//	session_cookie       会话 cookie 名, 默认 GoWebSessionId
+//	session_lifetime     会话的有效期 (秒), 默认 3600
+package framework
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type App struct {
+	Router   *RegistorController
+	Config   *Config
+	Sessions *SessionMgr
+
+	mu         sync.Mutex
+	server     *http.Server
+	listener   net.Listener
+	onStart    []func() error
+	onShutdown []func(ctx context.Context) error
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+	done         chan struct{} // Shutdown 执行完之后关闭
+}
+
+// NewApp 创建应用, cfg 为 nil 时全部使用默认配置
+func NewApp(cfg *Config) *App {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	a := &App{
+		Router: &RegistorController{},
+		Config: cfg,
+		done:   make(chan struct{}),
+	}
+
+	a.Sessions = NewSessionMgr(cfg.DefaultString("session_cookie", "GoWebSessionId"), int64(cfg.DefaultInt("session_lifetime", 3600)))
+	a.OnShutdown(func(ctx context.Context) error {
+		a.Sessions.Stop()
+		return nil
+	})
+
+	return a
+}
+
+// OnStart 添加启动时执行的函数, 在开始监听之后, 处理请求之前按注册顺序执行, 出错时 Run 返回该错误
+func (a *App) OnStart(fn func() error) {
+	a.onStart = append(a.onStart, fn)
+}
+
+// OnShutdown 添加关闭时执行的函数, 在正在处理的请求结束之后按注册的相反顺序执行,
+// 用于关闭数据库连接, 会话存储之类的资源. ctx 是关闭的期限.
+func (a *App) OnShutdown(fn func(ctx context.Context) error) {
+	a.onShutdown = append(a.onShutdown, fn)
+}
+
+// Addr 返回实际监听的地址, Run 之前返回 nil. addr 配置为 :0 时可以用它拿到分配的端口.
+func (a *App) Addr() net.Addr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Addr()
+}
+
+// Run 启动服务, 直到收到 SIGINT, SIGTERM 或者调用了 Shutdown. 正常关闭时返回 nil.
+func (a *App) Run() error {
+	select {
+	case <-a.done:
+		return http.ErrServerClosed
+	default:
+	}
+
+	srv := a.newServer()
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.server, a.listener = srv, ln
+	a.mu.Unlock()
+
+	for _, fn := range a.onStart {
+		if err := fn(); err != nil {
+			// 还没有 Serve, Shutdown 不会关闭 ln
+			ln.Close()
+			a.Shutdown(context.Background())
+			return err
+		}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		certFile, keyFile := a.Config.String("tls_cert"), a.Config.String("tls_key")
+		if certFile != "" || keyFile != "" {
+			serveErr <- srv.ServeTLS(ln, certFile, keyFile)
+		} else {
+			serveErr <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err == http.ErrServerClosed {
+			// 其他地方调用了 Shutdown, 等它执行完
+			<-a.done
+			return a.shutdownErr
+		}
+		a.Shutdown(context.Background())
+		return err
+
+	case sig := <-sigs:
+		log.Printf("received %s, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), a.Config.DefaultDuration("shutdown_timeout", 10*time.Second))
+		defer cancel()
+		return a.Shutdown(ctx)
+	}
+}
+
+// Shutdown 优雅地关闭服务: 不再接受新连接, 等正在处理的请求结束, 然后执行 OnShutdown.
+// ctx 到期时强制关闭剩下的连接. 多次调用只执行一次, 之后的调用等第一次执行完并返回同样的结果.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.shutdownOnce.Do(func() {
+		var errs []error
+
+		a.mu.Lock()
+		srv := a.server
+		a.mu.Unlock()
+
+		if srv != nil {
+			if err := srv.Shutdown(ctx); err != nil {
+				errs = append(errs, err)
+				srv.Close()
+			}
+		}
+
+		for i := len(a.onShutdown) - 1; i >= 0; i-- {
+			if err := a.onShutdown[i](ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		a.shutdownErr = errors.Join(errs...)
+		close(a.done)
+	})
+
+	<-a.done
+	return a.shutdownErr
+}
+
+func (a *App) newServer() *http.Server {
+	cfg := a.Config
+	srv := &http.Server{
+		Addr:              cfg.DefaultString("addr", ":8080"),
+		Handler:           a.Router,
+		ReadTimeout:       cfg.DefaultDuration("read_timeout", 30*time.Second),
+		ReadHeaderTimeout: cfg.DefaultDuration("read_header_timeout", 10*time.Second),
+		WriteTimeout:      cfg.DefaultDuration("write_timeout", 30*time.Second),
+		IdleTimeout:       cfg.DefaultDuration("idle_timeout", 120*time.Second),
+	}
+
+	// net/http 在 HTTPS 时自动启用 HTTP/2, TLSNextProto 不为 nil 就关掉了
+	if !cfg.DefaultBool("http2", true) {
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+
+	return srv
+}
@@ -0,0 +1,132 @@
+package framework
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func loadTestConfig(t *testing.T, content string) *Config {
+	file := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	return cfg
+}
+
+func TestAppShutdown(t *testing.T) {
+	app := NewApp(loadTestConfig(t, "addr = 127.0.0.1:0\n"))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	app.Router.Get("/slow", func(ctx *Context) error {
+		close(started)
+		<-release
+		_, err := io.WriteString(ctx.ResponseWriter, "done")
+		return err
+	})
+
+	var mu sync.Mutex
+	var calls []string
+	ready := make(chan struct{})
+	app.OnStart(func() error {
+		close(ready)
+		return nil
+	})
+	for _, name := range []string{"db", "cache"} {
+		name := name
+		app.OnShutdown(func(ctx context.Context) error {
+			mu.Lock()
+			calls = append(calls, name)
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- app.Run() }()
+	<-ready
+
+	type result struct {
+		body string
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + app.Addr().String() + "/slow")
+		if err != nil {
+			res <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		res <- result{string(b), err}
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- app.Shutdown(context.Background()) }()
+
+	// 正在处理的请求结束之前 Shutdown 不会返回
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown returned before the request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+
+	if r := <-res; r.err != nil || r.body != "done" {
+		t.Fatalf("bad response: got %q, %v", r.body, r.err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if want := []string{"cache", "db"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("bad shutdown hooks: got %v, want %v", calls, want)
+	}
+	if !app.Sessions.mStopped {
+		t.Fatalf("session gc not stopped")
+	}
+	if err := app.Run(); err != http.ErrServerClosed {
+		t.Fatalf("run after shutdown: got %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestAppStartError(t *testing.T) {
+	app := NewApp(loadTestConfig(t, "addr = 127.0.0.1:0\n"))
+
+	stopped := false
+	app.OnStart(func() error { return io.ErrUnexpectedEOF })
+	app.OnShutdown(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+
+	if err := app.Run(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("bad error: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if !stopped {
+		t.Fatalf("shutdown hooks not called")
+	}
+
+	// 端口已经释放
+	ln, err := net.Listen("tcp", app.Addr().String())
+	if err != nil {
+		t.Fatalf("port still in use: %v", err)
+	}
+	ln.Close()
+}
@@ -0,0 +1,223 @@
+// 静态文件指纹
+// 启动时 (或者用 blogctl assets 提前) 计算静态目录下每个文件的哈希, 生成 原文件名: 带哈希文件名 的清单.
+// 模板中用 {{asset "bootstrap/css/bootstrap.min.css"}} 得到 /public/bootstrap/css/bootstrap.min.3f9a1c2b4d5e.css,
+// 文件内容变了 URL 就跟着变, 所以带哈希的文件可以让浏览器永久缓存.
+//
+//	m, err := BuildAssetManifest(os.DirFS("public"), "/public")
+//	rc.Static("/public", "public", StaticOptions{Manifest: m})
+package framework
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Asset 是清单中的一个文件
+type Asset struct {
+	Path      string `json:"path"`      // 带哈希的文件名, 例如 css/app.3f9a1c2b4d5e.css
+	Integrity string `json:"integrity"` // Subresource Integrity, 例如 sha384-...
+}
+
+// AssetManifest 静态文件清单
+type AssetManifest struct {
+	Prefix string           `json:"prefix"` // 静态目录的 URL 前缀, 例如 /public
+	Assets map[string]Asset `json:"assets"` // 原文件名: Asset
+
+	hashed map[string]string // 带哈希的文件名: 原文件名
+}
+
+// BuildAssetManifest 计算 fsys 中所有文件的哈希, 以 . 开头的文件和预压缩的 .gz, .br 文件除外
+func BuildAssetManifest(fsys fs.FS, prefix string) (*AssetManifest, error) {
+	m := &AssetManifest{Prefix: strings.TrimSuffix(prefix, "/"), Assets: make(map[string]Asset)}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != "." && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".br") {
+			return nil
+		}
+
+		asset, err := hashAsset(fsys, name)
+		if err != nil {
+			return err
+		}
+		m.Assets[name] = asset
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.index()
+	return m, nil
+}
+
+func hashAsset(fsys fs.FS, name string) (Asset, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return Asset{}, err
+	}
+	defer f.Close()
+
+	fingerprint, integrity := sha256.New(), sha512.New384()
+	if _, err := io.Copy(io.MultiWriter(fingerprint, integrity), f); err != nil {
+		return Asset{}, err
+	}
+
+	ext := path.Ext(name)
+	hash := hex.EncodeToString(fingerprint.Sum(nil))[:12]
+	return Asset{
+		Path:      strings.TrimSuffix(name, ext) + "." + hash + ext,
+		Integrity: "sha384-" + base64.StdEncoding.EncodeToString(integrity.Sum(nil)),
+	}, nil
+}
+
+// LoadAssetManifest 读取 Save 保存的清单
+func LoadAssetManifest(file string) (*AssetManifest, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &AssetManifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("asset manifest %s: %v", file, err)
+	}
+	if m.Assets == nil {
+		m.Assets = make(map[string]Asset)
+	}
+
+	m.index()
+	return m, nil
+}
+
+// Verify 重新计算 fsys 中文件的哈希, 与清单不一致时返回错误. 清单生成之后改过的文件如果还按
+// 带哈希的文件名提供, 浏览器会把新的内容当成旧的永久缓存, 所以加载保存的清单之后要先校验.
+func (m *AssetManifest) Verify(fsys fs.FS) error {
+	current, err := BuildAssetManifest(fsys, m.Prefix)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(current.Assets))
+	for name := range current.Assets {
+		names = append(names, name)
+	}
+	for name := range m.Assets {
+		if _, ok := current.Assets[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		asset, ok := m.Assets[name]
+		now, exists := current.Assets[name]
+		switch {
+		case !exists:
+			return fmt.Errorf("asset manifest is stale: %s no longer exists", name)
+		case !ok:
+			return fmt.Errorf("asset manifest is stale: %s is missing", name)
+		case asset != now:
+			return fmt.Errorf("asset manifest is stale: %s has changed", name)
+		}
+	}
+	return nil
+}
+
+// Save 把清单以 JSON 格式保存到 file
+func (m *AssetManifest) Save(file string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(b, '\n'), 0644)
+}
+
+func (m *AssetManifest) index() {
+	m.hashed = make(map[string]string, len(m.Assets))
+	for name, asset := range m.Assets {
+		m.hashed[asset.Path] = name
+	}
+}
+
+// original 返回带哈希的文件名对应的原文件名
+func (m *AssetManifest) original(hashed string) (string, bool) {
+	name, ok := m.hashed[hashed]
+	return name, ok
+}
+
+func (m *AssetManifest) lookup(name string) (Asset, error) {
+	asset, ok := m.Assets[strings.TrimPrefix(name, "/")]
+	if !ok {
+		return Asset{}, fmt.Errorf("asset: %q is not in the manifest", name)
+	}
+	return asset, nil
+}
+
+// URL 返回文件 name 带哈希的 URL, name 是相对静态目录的路径
+func (m *AssetManifest) URL(name string) (string, error) {
+	asset, err := m.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return m.Prefix + "/" + asset.Path, nil
+}
+
+// Integrity 返回文件 name 的 SRI 值, 用于 <script> 和 <link> 的 integrity 属性
+func (m *AssetManifest) Integrity(name string) (string, error) {
+	asset, err := m.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return asset.Integrity, nil
+}
+
+// Tag 返回引用 .css 或 .js 文件的完整标签, 带 integrity 和 crossorigin 属性
+func (m *AssetManifest) Tag(name string) (template.HTML, error) {
+	asset, err := m.lookup(name)
+	if err != nil {
+		return "", err
+	}
+
+	url := template.HTMLEscapeString(m.Prefix + "/" + asset.Path)
+	integrity := template.HTMLEscapeString(asset.Integrity)
+	switch path.Ext(name) {
+	case ".css":
+		return template.HTML(`<link rel="stylesheet" href="` + url + `" integrity="` + integrity + `" crossorigin="anonymous">`), nil
+	case ".js":
+		return template.HTML(`<script src="` + url + `" integrity="` + integrity + `" crossorigin="anonymous"></script>`), nil
+	}
+	return "", fmt.Errorf("asset: no tag for %q, only .css and .js are supported", name)
+}
+
+// FuncMap 返回模板函数:
+//
+//	{{asset "css/app.css"}}           带哈希的 URL
+//	{{assetIntegrity "css/app.css"}}  SRI 值
+//	{{assetTag "css/app.css"}}        完整的 <link> 或 <script> 标签
+func (m *AssetManifest) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"asset":          m.URL,
+		"assetIntegrity": m.Integrity,
+		"assetTag":       m.Tag,
+	}
+}
@@ -0,0 +1,132 @@
+package framework
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func assetFS() fstest.MapFS {
+	return fstest.MapFS{
+		"css/app.css":    {Data: []byte("body{}")},
+		"css/app.css.gz": {Data: []byte("gzipped")},
+		"js/app.js":      {Data: []byte("console.log(1)")},
+		"logo.png":       {Data: []byte("png")},
+		".git/config":    {Data: []byte("secret")},
+	}
+}
+
+func TestAssetManifest(t *testing.T) {
+	m, err := BuildAssetManifest(assetFS(), "/public/")
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	if len(m.Assets) != 3 {
+		t.Fatalf("bad assets: got %v", m.Assets)
+	}
+
+	url, err := m.URL("css/app.css")
+	if err != nil || !regexp.MustCompile(`^/public/css/app\.[0-9a-f]{12}\.css$`).MatchString(url) {
+		t.Fatalf("bad url: got %q, %v", url, err)
+	}
+
+	sum := sha512.Sum384([]byte("body{}"))
+	want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	if got, _ := m.Integrity("css/app.css"); got != want {
+		t.Fatalf("bad integrity: got %q, want %q", got, want)
+	}
+
+	tag, err := m.Tag("js/app.js")
+	if err != nil || !regexp.MustCompile(`^<script src="/public/js/app\.[0-9a-f]{12}\.js" integrity="sha384-[^"]+" crossorigin="anonymous"></script>$`).MatchString(string(tag)) {
+		t.Fatalf("bad tag: got %q, %v", tag, err)
+	}
+	if _, err := m.Tag("logo.png"); err == nil {
+		t.Fatalf("tag png: want error")
+	}
+	if _, err := m.URL("missing.css"); err == nil {
+		t.Fatalf("missing asset: want error")
+	}
+
+	file := filepath.Join(t.TempDir(), "assets.json")
+	if err := m.Save(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	loaded, err := LoadAssetManifest(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, m) {
+		t.Fatalf("bad manifest: got %+v, want %+v", loaded, m)
+	}
+}
+
+func TestAssetManifestVerify(t *testing.T) {
+	m, _ := BuildAssetManifest(assetFS(), "/public")
+	if err := m.Verify(assetFS()); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	tests := []struct {
+		change func(fstest.MapFS)
+		err    string
+	}{
+		{func(fsys fstest.MapFS) { fsys["css/app.css"] = &fstest.MapFile{Data: []byte("body{color:red}")} }, "css/app.css has changed"},
+		{func(fsys fstest.MapFS) { fsys["js/new.js"] = &fstest.MapFile{Data: []byte("1")} }, "js/new.js is missing"},
+		{func(fsys fstest.MapFS) { delete(fsys, "logo.png") }, "logo.png no longer exists"},
+	}
+	for i, v := range tests {
+		fsys := assetFS()
+		v.change(fsys)
+		if err := m.Verify(fsys); err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Fatalf("%v: bad error: got %v, want %q", i+1, err, v.err)
+		}
+	}
+}
+
+func TestStaticManifest(t *testing.T) {
+	fsys := assetFS()
+	m, _ := BuildAssetManifest(fsys, "/public")
+
+	rc := &RegistorController{}
+	rc.StaticFS("/public", fsys, StaticOptions{Manifest: m, Precompressed: true})
+
+	url, _ := m.URL("css/app.css")
+	tests := []struct {
+		path         string
+		body         string
+		cacheControl string
+	}{
+		{url, "body{}", "public, max-age=31536000, immutable"},
+		{"/public/css/app.css", "body{}", "no-cache"},
+	}
+
+	for i, tt := range tests {
+		w := serve(rc, "GET", tt.path)
+		if w.Code != 200 || w.Body.String() != tt.body {
+			t.Fatalf("%v: bad response: got %d %q, want %q", i+1, w.Code, w.Body.String(), tt.body)
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+			t.Fatalf("%v: bad cache control: got %q, want %q", i+1, got, tt.cacheControl)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+			t.Fatalf("%v: bad content type: got %q", i+1, got)
+		}
+	}
+
+	if w := serve(rc, "GET", "/public/css/app.000000000000.css"); w.Code != 404 {
+		t.Fatalf("bad code: got %d, want %d", w.Code, 404)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("prefix mismatch: want panic")
+		}
+	}()
+	rc.StaticFS("/static", fsys, StaticOptions{Manifest: m})
+}
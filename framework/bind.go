@@ -0,0 +1,610 @@
+// 请求绑定和校验
+// Bind 按结构体 tag 从路由参数, query, 表单, multipart 和 JSON 请求体中填充结构体, 然后按 valid tag 校验:
+//
+//	type PostForm struct {
+//		ID    int       `param:"id"`
+//		Title string    `form:"title" json:"title" valid:"required,max=200"`
+//		Tags  []string  `form:"tag"`
+//		Date  time.Time `form:"date" time_format:"2006-01-02"`
+//		Cover *multipart.FileHeader `form:"cover"`
+//	}
+//
+// 没有 param tag 的字段从表单取值, 名字依次取 form tag, json tag, 字段名, tag 为 "-" 的字段不绑定.
+// JSON 请求体先整体解码, 之后 query 中出现的字段会覆盖解码的值. 请求中没有的字段保持原值, 可以预先填好默认值.
+package framework
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxMultipartMemory 是解析 multipart 表单时保存在内存中的最大字节数, 超过的部分写到临时文件
+var MaxMultipartMemory int64 = 32 << 20
+
+// DefaultMaxBodySize 是 RegistorController.MaxBodySize 的默认值
+const DefaultMaxBodySize = 32 << 20
+
+// limitBody 限制请求体最多读 n 个字节, 超过时读取请求体返回 *http.MaxBytesError, 解析表单之前调用.
+// 只有第一次调用生效, n 小于 0 时不限制.
+func (ctx *Context) limitBody(n int64) {
+	r := ctx.Request
+	if ctx.bodyLimited || n < 0 || r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+	ctx.bodyLimited = true
+	r.Body = http.MaxBytesReader(ctx.ResponseWriter, r.Body, n)
+}
+
+// maxBodySize 返回路由设置的请求体大小限制
+func (ctx *Context) maxBodySize() int64 {
+	if ctx.router == nil || ctx.router.MaxBodySize == 0 {
+		return DefaultMaxBodySize
+	}
+	return ctx.router.MaxBodySize
+}
+
+// bodyError 把解析请求体的错误转成 HTTPError, 请求体太大时是 413, 其他是 400
+func bodyError(err error, message string) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &HTTPError{Code: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit), Err: err}
+	}
+	return &HTTPError{Code: http.StatusBadRequest, Message: message, Err: err}
+}
+
+// FieldError 是一个字段的绑定或校验错误
+type FieldError struct {
+	Field   string // 表单中的字段名
+	Rule    string // 没有通过的校验规则, 类型转换失败时是 "type"
+	Message string // 可以直接展示在表单旁边的错误信息
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationErrors 是 Bind 和 Validate 返回的字段错误, 每个字段最多一个错误.
+// 放进模板之后可以这样显示: {{with .Errors.Get "title"}}<span class="error">{{.}}</span>{{end}}
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// StatusCode 让路由把没有处理的校验错误按 422 响应
+func (e ValidationErrors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// Get 返回字段 field 的错误信息, 没有错误时返回空字符串
+func (e ValidationErrors) Get(field string) string {
+	for _, fe := range e {
+		if fe.Field == field {
+			return fe.Message
+		}
+	}
+	return ""
+}
+
+// Map 返回 字段名: 错误信息
+func (e ValidationErrors) Map() map[string]string {
+	m := make(map[string]string, len(e))
+	for _, fe := range e {
+		m[fe.Field] = fe.Message
+	}
+	return m
+}
+
+// Bind 把请求绑定到 dst 并校验, dst 必须是结构体指针.
+// 请求体解析失败时返回 400 的 *HTTPError, 类型转换和校验失败时返回 ValidationErrors.
+func (ctx *Context) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind: dst must be a non-nil pointer to struct, got %T", dst)
+	}
+
+	fields, err := structFields(v.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	r := ctx.Request
+	ctx.limitBody(ctx.maxBodySize())
+	values, files, err := requestValues(r, dst)
+	if err != nil {
+		return err
+	}
+
+	typeErrs := make(map[*bindField]*FieldError)
+	for _, f := range fields {
+		if f.form == "-" && f.param == "" {
+			continue
+		}
+
+		fv := v.Elem().FieldByIndex(f.index)
+		if f.file {
+			setFiles(fv, files[f.form])
+			continue
+		}
+
+		var vals []string
+		if f.param != "" {
+			value, ok := ctx.Params[f.param]
+			if !ok {
+				continue
+			}
+			vals = []string{value}
+		} else if vals = values[f.form]; len(vals) == 0 {
+			continue
+		}
+
+		if err := setField(fv, vals, f.timeFormat); err != nil {
+			typeErrs[f] = &FieldError{Field: f.name, Rule: "type", Message: err.Error()}
+		}
+	}
+
+	if errs := validateFields(v.Elem(), fields, typeErrs); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Bind 同 Context.Bind
+func (c *Controller) Bind(dst interface{}) error {
+	return c.Ctx.Bind(dst)
+}
+
+// requestValues 解析请求体, 返回用于绑定的表单值和上传的文件. JSON 请求体直接解码到 dst, 表单值只有 query.
+func requestValues(r *http.Request, dst interface{}) (url.Values, map[string][]*multipart.FileHeader, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch {
+	case contentType == "application/json" || strings.HasSuffix(contentType, "+json"):
+		if r.Body != nil && r.Body != http.NoBody {
+			if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+				return nil, nil, bodyError(err, "invalid json body")
+			}
+		}
+		return r.URL.Query(), nil, nil
+
+	case contentType == "multipart/form-data":
+		if err := r.ParseMultipartForm(MaxMultipartMemory); err != nil {
+			return nil, nil, bodyError(err, "invalid multipart form")
+		}
+		return r.Form, r.MultipartForm.File, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, nil, bodyError(err, "invalid form")
+	}
+	return r.Form, nil, nil
+}
+
+// bindField 是结构体中一个需要绑定或校验的字段, 按类型缓存
+type bindField struct {
+	index      []int
+	name       string // 错误信息中的字段名
+	form       string // 表单中的字段名, "-" 表示不从表单绑定
+	param      string // 路由参数名
+	file       bool   // *multipart.FileHeader 或 []*multipart.FileHeader
+	timeFormat string
+	rules      []rule
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+var (
+	bindFieldsCache sync.Map // reflect.Type: []*bindField
+
+	fileHeaderType      = reflect.TypeOf(&multipart.FileHeader{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// structFields 解析结构体 t 的 tag, 内嵌结构体的字段提升到外层. 校验规则写错时返回错误.
+func structFields(t reflect.Type) ([]*bindField, error) {
+	if fields, ok := bindFieldsCache.Load(t); ok {
+		return fields.([]*bindField), nil
+	}
+
+	fields, err := parseStructFields(t, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	bindFieldsCache.Store(t, fields)
+	return fields, nil
+}
+
+func parseStructFields(t reflect.Type, index []int) ([]*bindField, error) {
+	var fields []*bindField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		idx := append(append([]int(nil), index...), i)
+
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && sf.Tag.Get("form") == "" {
+			embedded, err := parseStructFields(sf.Type, idx)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		f := &bindField{
+			index:      idx,
+			param:      sf.Tag.Get("param"),
+			timeFormat: sf.Tag.Get("time_format"),
+			file:       sf.Type == fileHeaderType || sf.Type == reflect.SliceOf(fileHeaderType),
+		}
+
+		f.form, _, _ = strings.Cut(sf.Tag.Get("form"), ",")
+		jsonName, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		switch {
+		case f.form != "":
+		case jsonName != "" && jsonName != "-":
+			f.form = jsonName
+		default:
+			f.form = sf.Name
+		}
+
+		f.name = f.form
+		if f.param != "" {
+			f.name = f.param
+		} else if f.name == "-" {
+			f.name = sf.Name
+		}
+
+		rules, err := parseRules(sf.Tag.Get("valid"))
+		if err != nil {
+			return nil, fmt.Errorf("bind: %s.%s: %v", t.Name(), sf.Name, err)
+		}
+		f.rules = rules
+
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func parseRules(tag string) ([]rule, error) {
+	if tag == "" {
+		return nil, nil
+	}
+
+	var rules []rule
+	for _, s := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(s), "=")
+		switch name {
+		case "required", "email", "url", "alpha", "alphanum", "numeric":
+		case "min", "max", "len":
+			if _, err := strconv.ParseFloat(param, 64); err != nil {
+				return nil, fmt.Errorf("rule %s needs a number, got %q", name, param)
+			}
+		case "oneof":
+			if strings.TrimSpace(param) == "" {
+				return nil, errors.New("rule oneof needs values")
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		rules = append(rules, rule{name: name, param: param})
+	}
+	return rules, nil
+}
+
+// setFiles 把上传的文件设置到 *multipart.FileHeader 或 []*multipart.FileHeader 字段
+func setFiles(v reflect.Value, files []*multipart.FileHeader) {
+	if len(files) == 0 {
+		return
+	}
+	if v.Kind() == reflect.Slice {
+		v.Set(reflect.ValueOf(files))
+		return
+	}
+	v.Set(reflect.ValueOf(files[0]))
+}
+
+// setField 把表单值转换成字段的类型, 切片字段使用所有的值, 其他字段使用第一个值
+func setField(v reflect.Value, values []string, timeFormat string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value, timeFormat); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0], timeFormat)
+}
+
+// 没有指定 time_format 时依次尝试的时间格式, 后两个是 <input type="date"> 和 <input type="datetime-local"> 的格式
+var timeFormats = []string{time.RFC3339, "2006-01-02", "2006-01-02T15:04"}
+
+func setValue(v reflect.Value, s string, timeFormat string) error {
+	if v.Kind() == reflect.Ptr {
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s, timeFormat); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		if s == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+
+		formats := timeFormats
+		if timeFormat != "" {
+			formats = []string{timeFormat}
+		}
+		for _, layout := range formats {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errors.New("must be a valid time")
+	}
+
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return errors.New("is invalid")
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		if s == "" {
+			v.SetBool(false)
+			return nil
+		}
+		if s == "on" {
+			// 没有 value 的 checkbox 选中时提交 on
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			v.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a non-negative integer")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("cannot be bound to %s", v.Type())
+	}
+	return nil
+}
+
+// Validate 按 valid tag 校验结构体 v, v 是结构体或结构体指针. 不通过时返回 ValidationErrors.
+// 支持的规则:
+//
+//	required       不能是零值, 字符串和切片不能为空
+//	min=n, max=n   数字的大小, 字符串的字符数, 切片的长度
+//	len=n          字符串的字符数或切片的长度
+//	email, url     邮箱地址, http 或 https 链接
+//	oneof=a b c    只能是列出的值之一
+//	alpha, alphanum, numeric  只能包含字母, 字母和数字, 数字
+//
+// 除了 required, 其他规则都会跳过空字符串, 空切片和 nil 指针.
+func Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: want struct, got %T", v)
+	}
+
+	fields, err := structFields(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	if errs := validateFields(rv, fields, nil); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateFields 按字段顺序校验, typeErrs 中有类型转换错误的字段直接使用该错误
+func validateFields(v reflect.Value, fields []*bindField, typeErrs map[*bindField]*FieldError) ValidationErrors {
+	var errs ValidationErrors
+	for _, f := range fields {
+		if fe, ok := typeErrs[f]; ok {
+			errs = append(errs, fe)
+			continue
+		}
+		if len(f.rules) == 0 {
+			continue
+		}
+
+		fv := v.FieldByIndex(f.index)
+		for _, r := range f.rules {
+			if msg := checkRule(fv, r); msg != "" {
+				errs = append(errs, &FieldError{Field: f.name, Rule: r.name, Message: msg})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// checkRule 检查一条规则, 通过时返回空字符串, 否则返回错误信息
+func checkRule(v reflect.Value, r rule) string {
+	if r.name == "required" {
+		if isEmptyValue(v) {
+			return "is required"
+		}
+		return ""
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if isEmptyValue(v) && v.Kind() != reflect.Bool && !isNumber(v) {
+		return ""
+	}
+
+	switch r.name {
+	case "min", "max", "len":
+		limit, _ := strconv.ParseFloat(r.param, 64)
+		size, unit := valueSize(v)
+		switch {
+		case r.name == "min" && size < limit:
+			return "must be at least " + r.param + unit
+		case r.name == "max" && size > limit:
+			return "must be at most " + r.param + unit
+		case r.name == "len" && size != limit:
+			return "must be exactly " + r.param + unit
+		}
+	case "email":
+		s := fmt.Sprint(v.Interface())
+		if addr, err := mail.ParseAddress(s); err != nil || addr.Address != s {
+			return "must be a valid email address"
+		}
+	case "url":
+		u, err := url.ParseRequestURI(fmt.Sprint(v.Interface()))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be a valid URL"
+		}
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		options := strings.Fields(r.param)
+		for _, o := range options {
+			if o == s {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	case "alpha":
+		if !allRunes(fmt.Sprint(v.Interface()), unicode.IsLetter) {
+			return "must contain only letters"
+		}
+	case "alphanum":
+		if !allRunes(fmt.Sprint(v.Interface()), func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			return "must contain only letters and digits"
+		}
+	case "numeric":
+		if !allRunes(fmt.Sprint(v.Interface()), unicode.IsDigit) {
+			return "must contain only digits"
+		}
+	}
+	return ""
+}
+
+// valueSize 返回 min, max, len 比较的大小和错误信息中的单位
+func valueSize(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	return 0, ""
+}
+
+func isNumber(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func allRunes(s string, fn func(rune) bool) bool {
+	for _, r := range s {
+		if !fn(r) {
+			return false
+		}
+	}
+	return true
+}
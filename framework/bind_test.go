@@ -0,0 +1,216 @@
+package framework
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindBase struct {
+	ID int `param:"id"`
+}
+
+type postForm struct {
+	bindBase
+	Title   string                `form:"title" json:"title" valid:"required,max=10"`
+	Email   string                `json:"email" valid:"email"`
+	Tags    []string              `form:"tag" valid:"max=2"`
+	Draft   bool                  `form:"draft"`
+	Score   *float64              `form:"score" valid:"min=0,max=5"`
+	Date    time.Time             `form:"date" time_format:"2006-01-02"`
+	Status  string                `form:"status" valid:"oneof=draft published"`
+	Ignored string                `form:"-"`
+	Cover   *multipart.FileHeader `form:"cover"`
+}
+
+func bindRequest(r *http.Request, params map[string]string, dst interface{}) error {
+	ctx := &Context{ResponseWriter: httptest.NewRecorder(), Request: r, Params: params}
+	return ctx.Bind(dst)
+}
+
+func TestBindForm(t *testing.T) {
+	body := "title=hello&email=a@b.c&tag=go&tag=web&draft=on&score=4.5&date=2020-01-02&status=draft&Ignored=x"
+	r := httptest.NewRequest("POST", "/posts/7?title=query", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var form postForm
+	if err := bindRequest(r, map[string]string{"id": "7"}, &form); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	score := 4.5
+	want := postForm{
+		bindBase: bindBase{ID: 7},
+		Title:    "hello",
+		Email:    "a@b.c",
+		Tags:     []string{"go", "web"},
+		Draft:    true,
+		Score:    &score,
+		Date:     time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local),
+		Status:   "draft",
+	}
+	if !reflect.DeepEqual(form, want) {
+		t.Fatalf("bad form: got %+v, want %+v", form, want)
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	r := httptest.NewRequest("POST", "/posts?status=published", strings.NewReader(`{"title":"json","email":"x@y.z"}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	form := postForm{Status: "draft"}
+	if err := bindRequest(r, nil, &form); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if form.Title != "json" || form.Email != "x@y.z" || form.Status != "published" {
+		t.Fatalf("bad form: got %+v", form)
+	}
+
+	r = httptest.NewRequest("POST", "/posts", strings.NewReader(`{"title":`))
+	r.Header.Set("Content-Type", "application/json")
+	err := bindRequest(r, nil, &form)
+	if code := StatusCode(err); code != http.StatusBadRequest {
+		t.Fatalf("bad json: got %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestBindBodySize(t *testing.T) {
+	big := `{"title":"` + strings.Repeat("x", 64) + `"}`
+	tests := []struct {
+		contentType string
+		body        string
+		limit       int64
+		code        int
+	}{
+		{"application/json", big, 32, http.StatusRequestEntityTooLarge},
+		{"application/json", big, 1024, 0},
+		{"application/json", big, -1, 0},
+		{"application/x-www-form-urlencoded", "title=" + strings.Repeat("x", 64), 32, http.StatusRequestEntityTooLarge},
+	}
+
+	for i, tt := range tests {
+		r := httptest.NewRequest("POST", "/posts", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		ctx := &Context{ResponseWriter: httptest.NewRecorder(), Request: r, router: &RegistorController{MaxBodySize: tt.limit}}
+
+		var form struct{ Title string }
+		if code := StatusCode(ctx.Bind(&form)); tt.code != 0 && code != tt.code {
+			t.Fatalf("%v: bad status: got %d, want %d", i+1, code, tt.code)
+		}
+		if tt.code == 0 && len(form.Title) != 64 {
+			t.Fatalf("%v: bad title: got %q", i+1, form.Title)
+		}
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "upload")
+	fw, _ := mw.CreateFormFile("cover", "cover.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/posts", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var form postForm
+	if err := bindRequest(r, nil, &form); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if form.Title != "upload" || form.Cover == nil || form.Cover.Filename != "cover.png" {
+		t.Fatalf("bad form: got %+v", form)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		want map[string]string
+	}{
+		{"title=ok", map[string]string{}},
+		{"", map[string]string{"title": "is required"}},
+		{"title=%20%20", map[string]string{"title": "is required"}},
+		{"title=01234567890", map[string]string{"title": "must be at most 10 characters"}},
+		{"title=ok&email=nope", map[string]string{"email": "must be a valid email address"}},
+		{"title=ok&tag=a&tag=b&tag=c", map[string]string{"tag": "must be at most 2 items"}},
+		{"title=ok&score=abc", map[string]string{"score": "must be a number"}},
+		{"title=ok&score=9", map[string]string{"score": "must be at most 5"}},
+		{"title=ok&draft=maybe", map[string]string{"draft": "must be true or false"}},
+		{"title=ok&date=02/01/2020", map[string]string{"date": "must be a valid time"}},
+		{"title=ok&status=deleted", map[string]string{"status": "must be one of draft, published"}},
+		{"email=x&score=-1", map[string]string{"title": "is required", "email": "must be a valid email address", "score": "must be at least 0"}},
+	}
+
+	for i, tt := range tests {
+		r := httptest.NewRequest("POST", "/posts", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		var form postForm
+		err := bindRequest(r, map[string]string{"id": "1"}, &form)
+
+		got := map[string]string{}
+		if err != nil {
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				t.Fatalf("%v: bad error type: got %T", i+1, err)
+			}
+			got = errs.Map()
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%v: bad errors: got %v, want %v", i+1, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/posts/x", nil)
+	err := bindRequest(r, map[string]string{"id": "x"}, &postForm{Title: "ok"})
+	if errs, ok := err.(ValidationErrors); !ok || errs.Get("id") != "must be an integer" {
+		t.Fatalf("bad param error: got %v", err)
+	}
+	if code := StatusCode(err); code != http.StatusUnprocessableEntity {
+		t.Fatalf("bad status: got %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type user struct {
+		Name  string `valid:"required,alpha,len=3"`
+		Code  string `valid:"numeric"`
+		Site  string `valid:"url"`
+		Roles []string
+	}
+
+	tests := []struct {
+		in   user
+		want string
+	}{
+		{user{Name: "abc", Code: "123", Site: "https://example.com"}, ""},
+		{user{Name: "ab1"}, "Name must contain only letters"},
+		{user{Name: "abcd"}, "Name must be exactly 3 characters"},
+		{user{Name: "abc", Code: "12a"}, "Code must contain only digits"},
+		{user{Name: "abc", Site: "javascript:alert(1)"}, "Site must be a valid URL"},
+	}
+
+	for i, tt := range tests {
+		err := Validate(&tt.in)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Fatalf("%v: bad error: got %q, want %q", i+1, got, tt.want)
+		}
+	}
+
+	type bad struct {
+		Name string `valid:"required,nope"`
+	}
+	if err := Validate(bad{}); err == nil || !strings.Contains(err.Error(), `unknown rule "nope"`) {
+		t.Fatalf("bad rule: got %v", err)
+	}
+}
@@ -1,113 +1,378 @@
 package framework
 
 import (
-	"bufio"
 	"bytes"
-	"io"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
-	"unicode"
-)
-
-var (
-	bCommont = []byte{'#'}
-	bEmpty = []byte{}
-	bEqual = []byte{'='}
-	bDQuote = []byte{'"'}
+	"time"
 )
 
+// DefaultSection is the section for keys that appear before any [section] header.
+const DefaultSection = "default"
 
+// Config is an INI-style configuration:
+//
+//	# comment
+//	appname = blog
+//	runmode = ${BLOG_RUNMODE||dev}
+//	include secrets.conf
+//
+//	[db]
+//	host = ${DB_HOST||127.0.0.1}
+//
+//	[prod]
+//	db.host = db.internal
+//
+// Keys are looked up as "key" in the default section, or "section::key" and
+// "section.key" in a named section. When runmode is set, the section named
+// after it overrides the others: "db.host" in [prod] (or "host" in [prod.db])
+// wins over "host" in [db].
 type Config struct {
-	filename string
-	comment  map[int][]string  	// id: []{comment, key...}; id 1 is for main comment.
-	data map[string]string		// key: value
-	offset   map[string]int64  	// key: offset; for editing.
-	mu sync.RWMutex
+	filename  string
+	runMode   string
+	sections  []string                     // section names in the order they first appear
+	comment   map[string]map[int][]string  // section: id: []{comment, key...}
+	data      map[string]map[string]string // section: key: value
+	offset    map[string]map[string]int64  // section: key: offset; for editing.
+	pos       map[string]map[string]string // section: key: file:line; for error messages.
+	edited    map[string]map[string]bool   // section: key: changed by Set or Delete since the last save
+	files     []string                     // the file and the files it includes; for watching.
+	providers []ConfigProvider             // the layers of LoadLayeredConfig; for reloading.
+	secretKey []byte                       // decrypts "enc:" values; see SetSecretKey.
+	secrets   secretCache                  // the key from the environment when secretKey is nil.
+	mu        sync.RWMutex
+
+	subscribers map[string][]func(old, new string) // key: OnChange callbacks
+	watch       *configWatch
 }
 
 func LoadConfig(filename string) (*Config, error) {
-	file, err := os.OpenFile(filename, os.O_RDONLY, 0)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
 	cfg := &Config{
-		filename:file.Name(),
-		comment: map[int][]string{},
-		data: map[string]string{},
-		offset: map[string]int64{},
-		mu: sync.RWMutex{},
+		filename: filename,
+		comment:  map[string]map[int][]string{},
+		data:     map[string]map[string]string{},
+		offset:   map[string]map[string]int64{},
+		pos:      map[string]map[string]string{},
 	}
 
 	cfg.mu.Lock()
 	defer cfg.mu.Unlock()
 
-	var comment bytes.Buffer
+	if err := cfg.parseFile(filename, true, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	cfg.runMode = cfg.data[DefaultSection]["runmode"]
 
-	buf := bufio.NewReader(file)
+	return cfg, nil
+}
 
-	for line, _, err := buf.ReadLine(); err != io.EOF; {
-		if err != nil {
-			return nil, err
-		}
-		nComment, off := 0, int64(1)
+// parseFile 读取 filename 中的配置, main 为 false 时是 include 进来的文件, 不记录 offset
+func (c *Config) parseFile(filename string, main bool, including map[string]bool) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if including[abs] {
+		return fmt.Errorf("config: %s: include cycle", filename)
+	}
+	including[abs] = true
+	defer delete(including, abs)
 
-		if bytes.Equal(line, bEmpty) {
-			continue
+	c.files = append(c.files, filename)
+
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	entries, err := lexConfig(filename, string(src))
+	if err != nil {
+		return err
+	}
+
+	// lineEnd[i] 是第 i+1 行结束 (换行符之后) 的位置
+	var lineEnd []int64
+	for off, b := range src {
+		if b == '\n' {
+			lineEnd = append(lineEnd, int64(off)+1)
 		}
+	}
+	lineEnd = append(lineEnd, int64(len(src)))
+
+	var comment bytes.Buffer
 
-		off += int64(len(line))
+	section := DefaultSection
+	c.addSection(section)
 
-		if bytes.HasPrefix(line, bCommont) {
-			line = bytes.TrimLeft(line, string(bCommont))
-			line = bytes.TrimFunc(line, unicode.IsSpace)
+	for _, e := range entries {
+		switch e.kind {
+		case configBlank:
+			continue
 
-			comment.Write(line)
+		case configComment:
+			comment.WriteString(e.value)
 			comment.WriteByte('\n')
 			continue
+
+		case configSection:
+			section = e.name
+			c.addSection(section)
 		}
 
+		// 注释属于下面的段或键
 		if comment.Len() != 0 {
-			cfg.comment[nComment] = []string{comment.String()}
-
-			nComment++
+			id := len(c.comment[section])
+			c.comment[section][id] = []string{comment.String()}
 			comment.Reset()
 		}
 
-		val := bytes.SplitN(line, bEqual, 2)
-		if bytes.HasPrefix(val[1], bDQuote) {
-			val[1] = bytes.Trim(val[1], string(bDQuote))
+		switch e.kind {
+		case configInclude:
+			// 相对路径相对于当前文件所在的目录
+			include := expandEnv(e.name)
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(filename), include)
+			}
+			if err := c.parseFile(include, false, including); err != nil {
+				return err
+			}
+
+		case configKey:
+			key := e.name
+			c.data[section][key] = expandEnv(e.value)
+
+			if id := len(c.comment[section]) - 1; id >= 0 {
+				c.comment[section][id] = append(c.comment[section][id], key)
+			}
+			c.pos[section][key] = fmt.Sprintf("%s:%d", filename, e.line)
+			if main {
+				c.offset[section][key] = lineEnd[e.endLine-1]
+			}
 		}
+	}
+
+	return nil
+}
 
-		key := string(bytes.TrimSpace(val[0]))
-		cfg.data[key] = string(bytes.TrimSpace(val[1]))
+func (c *Config) addSection(section string) {
+	if _, ok := c.data[section]; ok {
+		return
+	}
+	if c.data == nil {
+		c.comment = map[string]map[int][]string{}
+		c.data = map[string]map[string]string{}
+		c.offset = map[string]map[string]int64{}
+		c.pos = map[string]map[string]string{}
+	}
+	c.sections = append(c.sections, section)
+	c.comment[section] = map[int][]string{}
+	c.data[section] = map[string]string{}
+	c.offset[section] = map[string]int64{}
+	c.pos[section] = map[string]string{}
+}
+
+// expandEnv 替换 ${ENV} 和 ${ENV||default}, 环境变量没有设置或者为空时使用 default
+func expandEnv(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			break
+		}
 
-		cfg.comment[nComment-1] = append(cfg.comment[nComment-1], key)
-		cfg.offset[key] = off
+		name, def, _ := strings.Cut(s[i+2:i+j], "||")
+		b.WriteString(s[:i])
+		if value := os.Getenv(strings.TrimSpace(name)); value != "" {
+			b.WriteString(value)
+		} else {
+			b.WriteString(def)
+		}
+		s = s[i+j+1:]
 	}
 
-	return cfg, nil
+	b.WriteString(s)
+	return b.String()
+}
+
+// splitKey 返回 key 可能对应的 段, 键:
+// db::host 只对应 db 段的 host; db.host 先找 db 段的 host, 再找默认段的 db.host
+func splitKey(key string) [][2]string {
+	if section, name, ok := strings.Cut(key, "::"); ok {
+		return [][2]string{{section, name}}
+	}
+	if i := strings.LastIndexByte(key, '.'); i > 0 {
+		return [][2]string{{key[:i], key[i+1:]}, {DefaultSection, key}}
+	}
+	return [][2]string{{DefaultSection, key}}
+}
+
+// lookup 按运行模式段, 所在段的顺序查找 key
+func (c *Config) lookup(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.value(key)
+}
+
+// value 同 lookup, 调用者需要持有锁. 加密的值返回解密后的内容.
+func (c *Config) value(key string) (string, bool) {
+	section, name, ok := c.locate(key)
+	if !ok {
+		return "", false
+	}
+	return c.decrypt(key, c.data[section][name]), true
 }
 
+// locate 返回 key 实际所在的 段, 键, 调用者需要持有锁
+func (c *Config) locate(key string) (string, string, bool) {
+	for _, k := range splitKey(key) {
+		section, name := k[0], k[1]
+		if c.runMode != "" && section != c.runMode {
+			if section == DefaultSection {
+				if _, ok := c.data[c.runMode][name]; ok {
+					return c.runMode, name, true
+				}
+			} else {
+				if _, ok := c.data[c.runMode][section+"."+name]; ok {
+					return c.runMode, section + "." + name, true
+				}
+				if _, ok := c.data[c.runMode+"."+section][name]; ok {
+					return c.runMode + "." + section, name, true
+				}
+			}
+		}
+		if _, ok := c.data[section][name]; ok {
+			return section, name, true
+		}
+	}
+	return "", "", false
+}
+
+// RunMode returns the run mode, the value of "runmode" in the default section.
+func (c *Config) RunMode() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.runMode
+}
+
+// Sections returns the section names in the order they appear in the file.
+func (c *Config) Sections() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.sections...)
+}
+
+// Section returns a copy of the keys in a section, with run mode overrides applied,
+// or nil if the section does not exist.
+func (c *Config) Section(section string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	values, ok := c.data[section]
+	if !ok {
+		return nil
+	}
+
+	m := make(map[string]string, len(values))
+	for key, value := range values {
+		m[key] = value
+	}
+	defer func() {
+		for key, value := range m {
+			m[key] = c.decrypt(section+"::"+key, value)
+		}
+	}()
+	if c.runMode == "" || section == c.runMode {
+		return m
+	}
+
+	for key, value := range c.data[c.runMode] {
+		if section == DefaultSection {
+			// 带 . 的键是其他段的覆盖, 除非默认段中就有这个键
+			if _, ok := values[key]; ok || !strings.Contains(key, ".") {
+				m[key] = value
+			}
+		} else if name := strings.TrimPrefix(key, section+"."); name != key {
+			m[name] = value
+		}
+	}
+	for key, value := range c.data[c.runMode+"."+section] {
+		m[key] = value
+	}
+	return m
+}
 
 // Bool returns the boolean value for a given key.
 func (c *Config) Bool(key string) (bool, error) {
-	return strconv.ParseBool(c.data[key])
+	return strconv.ParseBool(c.String(key))
 }
 
 // Int returns the integer value for a given key.
 func (c *Config) Int(key string) (int, error) {
-	return strconv.Atoi(c.data[key])
+	return strconv.Atoi(c.String(key))
 }
 
 // Float returns the float value for a given key.
 func (c *Config) Float(key string) (float64, error) {
-	return strconv.ParseFloat(c.data[key], 64)
+	return strconv.ParseFloat(c.String(key), 64)
 }
 
-// String returns the string value for a given key.
+// String returns the string value for a given key. Values written as
+// "enc:..." are decrypted, see SetSecretKey; use Secret to get the error.
 func (c *Config) String(key string) string {
-	return c.data[key]
-}
\ No newline at end of file
+	value, _ := c.lookup(key)
+	return value
+}
+
+// Duration returns the duration value for a given key, such as "30s" or "1m30s".
+// A plain integer is treated as seconds.
+func (c *Config) Duration(key string) (time.Duration, error) {
+	return parseDuration(c.String(key))
+}
+
+// parseDuration 解析 30s, 1m30s 之类的时间, 只有数字时单位是秒
+func parseDuration(value string) (time.Duration, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// DefaultString returns the string value for a given key, or def if the key is not set.
+func (c *Config) DefaultString(key, def string) string {
+	if value, ok := c.lookup(key); ok && value != "" {
+		return value
+	}
+	return def
+}
+
+// DefaultInt returns the integer value for a given key, or def if the key is not set or invalid.
+func (c *Config) DefaultInt(key string, def int) int {
+	if n, err := c.Int(key); err == nil {
+		return n
+	}
+	return def
+}
+
+// DefaultBool returns the boolean value for a given key, or def if the key is not set or invalid.
+func (c *Config) DefaultBool(key string, def bool) bool {
+	if b, err := c.Bool(key); err == nil {
+		return b
+	}
+	return def
+}
+
+// DefaultDuration returns the duration value for a given key, or def if the key is not set or invalid.
+func (c *Config) DefaultDuration(key string, def time.Duration) time.Duration {
+	if d, err := c.Duration(key); err == nil {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,450 @@
+// 配置文件格式
+// JSON, TOML 和 YAML 都转换成和 INI 一样的 段: 键: 值, 嵌套的表或映射对应段, 段名用 . 连接,
+// 数组写成逗号分隔的值, 所以同一份配置换一种格式之后用法不变:
+//
+//	[db]                 {"db": {"host": "x"}}       db:
+//	host = x                                           host: x
+//
+// TOML 和 YAML 只支持配置文件中常用的部分, 遇到不支持的写法时返回带行号的错误.
+package framework
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// joinSection 返回 parent 下名为 name 的段
+func joinSection(parent, name string) string {
+	if parent == DefaultSection {
+		return name
+	}
+	return parent + "." + name
+}
+
+func parseJSONConfig(filename string) (*Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("config: %s: %v", filename, err)
+	}
+
+	cfg := &Config{filename: filename, files: []string{filename}}
+	if err := cfg.putJSON(filename, DefaultSection, doc); err != nil {
+		return nil, err
+	}
+	cfg.runMode = cfg.data[DefaultSection]["runmode"]
+	return cfg, nil
+}
+
+func (c *Config) putJSON(filename, section string, obj map[string]interface{}) error {
+	c.addSection(section)
+
+	// 先放值再放子段, 段按名字排序, 和文件中的顺序无关但是每次都一样
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if sub, ok := obj[key].(map[string]interface{}); ok {
+			if err := c.putJSON(filename, joinSection(section, key), sub); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := jsonScalar(obj[key])
+		if err != nil {
+			return fmt.Errorf("config: %s: %s: %v", filename, joinSection(section, key), err)
+		}
+		c.put(section, key, value, filename)
+	}
+	return nil
+}
+
+func jsonScalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := jsonScalar(item)
+			if err != nil || strings.Contains(s, ",") {
+				return "", errors.New("arrays can only contain scalars without commas")
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("objects are not supported here")
+}
+
+func parseTOMLConfig(filename string) (*Config, error) {
+	lines, err := readConfigLines(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{filename: filename, files: []string{filename}}
+	cfg.addSection(DefaultSection)
+	section := DefaultSection
+
+	for i, line := range lines {
+		fail := func(msg string) error {
+			return fmt.Errorf("config: %s:%d: %s", filename, i+1, msg)
+		}
+
+		line = strings.TrimSpace(stripComment(line))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "[["):
+			return nil, fail("arrays of tables are not supported")
+		case line[0] == '[':
+			if !strings.HasSuffix(line, "]") {
+				return nil, fail("unterminated table header")
+			}
+			name, err := tomlKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fail(err.Error())
+			}
+			section = name
+			cfg.addSection(section)
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fail("expected key = value")
+		}
+		key, err := tomlKey(line[:eq])
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		value, err := tomlValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+
+		// a.b = 1 是表 a 中的 b
+		target := section
+		if i := strings.LastIndexByte(key, '.'); i >= 0 {
+			target, key = joinSection(section, key[:i]), key[i+1:]
+		}
+		cfg.put(target, key, value, fmt.Sprintf("%s:%d", filename, i+1))
+	}
+
+	cfg.runMode = cfg.data[DefaultSection]["runmode"]
+	return cfg, nil
+}
+
+// tomlKey 解析表名或键, 由 . 连接的各部分可以是裸键或者带引号的键
+func tomlKey(s string) (string, error) {
+	var parts []string
+	for _, part := range strings.Split(s, ".") {
+		part = strings.TrimSpace(part)
+		if len(part) >= 2 && (part[0] == '"' || part[0] == '\'') && part[len(part)-1] == part[0] {
+			part = part[1 : len(part)-1]
+		} else if part == "" || strings.ContainsAny(part, " \t\"'=[]") {
+			return "", fmt.Errorf("invalid key %q", strings.TrimSpace(s))
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+func tomlValue(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", errors.New("missing value")
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return "", errors.New("multi-line strings are not supported")
+	case s[0] == '"':
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return value, nil
+	case s[0] == '\'':
+		if len(s) < 2 || !strings.HasSuffix(s, "'") || strings.Contains(s[1:len(s)-1], "'") {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s[0] == '[':
+		return listValue(s, tomlValue)
+	case s[0] == '{':
+		return "", errors.New("inline tables are not supported")
+	case strings.ContainsAny(s, " \t"):
+		return "", fmt.Errorf("invalid value %s", s)
+	}
+	// 数字, 布尔值和日期原样保留
+	return s, nil
+}
+
+func parseYAMLConfig(filename string) (*Config, error) {
+	lines, err := readConfigLines(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{filename: filename, files: []string{filename}}
+	cfg.addSection(DefaultSection)
+
+	// frame 是一个值在下面几行中的键: 子映射或者列表
+	type frame struct {
+		indent  int
+		section string // 键所在的段
+		key     string
+		line    int
+		items   []string
+		mapping bool
+	}
+	var stack []*frame
+
+	// pop 结束一个键, 列表写成逗号分隔的值, 什么都没有的键值为空
+	pop := func() {
+		f := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !f.mapping {
+			cfg.put(f.section, f.key, strings.Join(f.items, ","), fmt.Sprintf("%s:%d", filename, f.line))
+		}
+	}
+
+	for i, raw := range lines {
+		fail := func(msg string) error {
+			return fmt.Errorf("config: %s:%d: %s", filename, i+1, msg)
+		}
+
+		line := strings.TrimRight(stripComment(raw), " \t")
+		content := strings.TrimLeft(line, " ")
+		if content == "" || content == "---" || content == "..." {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, fail("tabs are not allowed for indentation")
+		}
+		indent := len(line) - len(content)
+
+		// - item 属于上一个没有值的键, 可以和键对齐也可以缩进
+		if content == "-" || strings.HasPrefix(content, "- ") {
+			if len(stack) == 0 || stack[len(stack)-1].mapping || indent < stack[len(stack)-1].indent {
+				return nil, fail("list item without a key")
+			}
+			item := strings.TrimSpace(content[1:])
+			if strings.HasPrefix(item, "- ") || yamlKeyEnd(item) >= 0 {
+				return nil, fail("only lists of scalars are supported")
+			}
+			value, err := yamlScalar(item)
+			if err != nil {
+				return nil, fail(err.Error())
+			}
+			if strings.Contains(value, ",") {
+				return nil, fail("list items cannot contain commas")
+			}
+			f := stack[len(stack)-1]
+			f.items = append(f.items, value)
+			continue
+		}
+
+		for len(stack) > 0 && indent <= stack[len(stack)-1].indent {
+			pop()
+		}
+
+		section := DefaultSection
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			if len(parent.items) > 0 {
+				return nil, fail("mapping inside a list")
+			}
+			parent.mapping = true
+			section = joinSection(parent.section, parent.key)
+			cfg.addSection(section)
+		}
+
+		end := yamlKeyEnd(content)
+		if end < 0 {
+			return nil, fail("expected key: value")
+		}
+		key, err := yamlScalar(content[:end])
+		if err != nil || key == "" {
+			return nil, fail("invalid key")
+		}
+
+		rest := strings.TrimSpace(content[end+1:])
+		if rest == "" {
+			stack = append(stack, &frame{indent: indent, section: section, key: key, line: i + 1})
+			continue
+		}
+		if rest[0] == '|' || rest[0] == '>' {
+			return nil, fail("block scalars are not supported")
+		}
+		value, err := yamlScalar(rest)
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		cfg.put(section, key, value, fmt.Sprintf("%s:%d", filename, i+1))
+	}
+	for len(stack) > 0 {
+		pop()
+	}
+
+	cfg.runMode = cfg.data[DefaultSection]["runmode"]
+	return cfg, nil
+}
+
+// yamlKeyEnd 返回 key: value 中冒号的位置, 冒号后面必须是空白或者行尾, 不是映射时返回 -1
+func yamlKeyEnd(s string) int {
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			if i == 0 {
+				quote = s[i]
+			}
+		case s[i] == ':' && (i+1 == len(s) || s[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "" || s == "~" || s == "null":
+		return "", nil
+	case s[0] == '"':
+		value, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return value, nil
+	case s[0] == '\'':
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s[0] == '[':
+		return listValue(s, yamlScalar)
+	case s[0] == '{':
+		return "", errors.New("flow mappings are not supported")
+	case s[0] == '&' || s[0] == '*' || s[0] == '!':
+		return "", errors.New("anchors, aliases and tags are not supported")
+	}
+	return s, nil
+}
+
+// listValue 解析单行的 [a, b, c], 每一项用 scalar 解析, 结果是逗号分隔的值
+func listValue(s string, scalar func(string) (string, error)) (string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return "", errors.New("unterminated array")
+	}
+
+	var items []string
+	for _, item := range splitOutsideQuotes(s[1:len(s)-1], ',') {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if item[0] == '[' || item[0] == '{' {
+			return "", errors.New("nested arrays are not supported")
+		}
+		value, err := scalar(item)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(value, ",") {
+			return "", errors.New("array items cannot contain commas")
+		}
+		items = append(items, value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+// splitOutsideQuotes 按不在引号中的 sep 分割 s
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	quote, start := byte(0), 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// stripComment 去掉不在引号中, 在行首或者空白之后的 # 开始的注释.
+// 引号只有在值的开头才算, it's 这样的值中间的单引号是普通字符.
+func stripComment(s string) string {
+	quote := byte(0)
+	prev := byte(0) // 上一个不是空白的字符
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case (s[i] == '"' || s[i] == '\'') && (prev == 0 || strings.IndexByte(":=-[{,.", prev) >= 0):
+			quote = s[i]
+		case s[i] == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+		if s[i] != ' ' && s[i] != '\t' {
+			prev = s[i]
+		}
+	}
+	return s
+}
+
+// readConfigLines 读取文件的所有行, 不含换行符
+func readConfigLines(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	return lines, scanner.Err()
+}
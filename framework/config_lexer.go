@@ -0,0 +1,277 @@
+// 配置文件的语法
+// LoadConfig 读取的文件按行分成条目:
+//
+//	# 注释
+//	[section]                    # 段, 后面可以有注释
+//	include other.conf
+//	key = value                  # 值后面空白加 # 开始的是注释
+//	key = "quoted # value\n"     # 引号中的 # 不是注释, 支持 \" \\ \n \r \t 转义
+//	key = first, \
+//	      second                 # 以 \ 结尾的行和下一行连起来, 下一行开头的空白去掉
+//	key = <<EOF
+//	多行的值, 原样保留
+//	EOF
+//
+// 语法错误以 *ConfigError 返回, 带行号和列号.
+package framework
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ConfigError 是配置文件的语法错误
+type ConfigError struct {
+	File   string
+	Line   int // 从 1 开始
+	Column int // 从 1 开始, 按字符计算
+	Msg    string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("config: %s:%d:%d: %s", e.File, e.Line, e.Column, e.Msg)
+}
+
+type configEntryKind int
+
+const (
+	configBlank configEntryKind = iota
+	configComment
+	configSection
+	configInclude
+	configKey
+)
+
+// configEntry 是配置文件中的一个条目, 占 line 到 endLine 的一行或者多行
+type configEntry struct {
+	kind          configEntryKind
+	line, endLine int
+	name          string // 段名, 键或者 include 的文件
+	value         string // 键的值, 注释行的内容
+	quoted        bool   // 值带引号
+	heredoc       string // 多行的值的结束标记
+	comment       string // 值后面的注释, 包括 #
+}
+
+// lexConfig 把配置文件的内容 src 分成条目, filename 只用于错误信息
+func lexConfig(filename, src string) ([]configEntry, error) {
+	lines := strings.Split(src, "\n")
+	if strings.HasSuffix(src, "\n") || src == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	var entries []configEntry
+	for i := 0; i < len(lines); i++ {
+		raw := lines[i]
+		line := strings.TrimSpace(raw)
+		lead := strings.Index(raw, line)
+
+		// fail 返回第 i 行 raw 中字节位置 off 处的错误
+		fail := func(off int, format string, args ...interface{}) error {
+			return &ConfigError{File: filename, Line: i + 1, Column: column(lines[i], off), Msg: fmt.Sprintf(format, args...)}
+		}
+
+		e := configEntry{line: i + 1, endLine: i + 1}
+		switch {
+		case line == "":
+			e.kind = configBlank
+
+		case line[0] == '#':
+			e.kind = configComment
+			e.value = strings.TrimSpace(strings.TrimLeft(line, "#"))
+
+		case line[0] == '[':
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return nil, fail(lead+len(line), "missing ] in section header")
+			}
+			e.kind = configSection
+			e.name = strings.TrimSpace(line[1:end])
+			if e.name == "" {
+				return nil, fail(lead, "empty section name")
+			}
+			if strings.ContainsAny(e.name, "[\"#") {
+				return nil, fail(lead+1, "invalid section name %q", e.name)
+			}
+			rest := line[end+1:]
+			if after := strings.TrimSpace(rest); after != "" && after[0] != '#' {
+				return nil, fail(lead+end+1+strings.Index(rest, after), "unexpected %q after section header", after)
+			}
+
+		case strings.HasPrefix(line, "include ") && !strings.Contains(line, "="):
+			e.kind = configInclude
+			e.name, e.comment = splitComment(line[len("include "):])
+			if e.name == "" {
+				return nil, fail(lead+len(line), "missing file name after include")
+			}
+
+		default:
+			eq := strings.IndexByte(line, '=')
+			if eq < 0 {
+				return nil, fail(lead+len(line), "expected = after key %q", line)
+			}
+			e.kind = configKey
+			e.name = strings.TrimSpace(line[:eq])
+			if e.name == "" {
+				return nil, fail(lead+eq, "missing key before =")
+			}
+			if i := strings.IndexAny(e.name, "\"#[]"); i >= 0 {
+				return nil, fail(lead+i, "invalid character %q in key", e.name[i])
+			}
+
+			rest := line[eq+1:]
+			value := strings.TrimLeft(rest, " \t")
+			off := lead + eq + 1 + len(rest) - len(value)
+
+			switch {
+			case strings.HasPrefix(value, `"`):
+				s, n, err := unquoteConfig(value)
+				if err != nil {
+					return nil, fail(off+n, "%s", err)
+				}
+				after := strings.TrimSpace(value[n:])
+				if after != "" && after[0] != '#' {
+					return nil, fail(off+n+strings.Index(value[n:], after), "unexpected %q after quoted value", after)
+				}
+				e.value, e.quoted, e.comment = s, true, after
+
+			case isHeredoc(value):
+				marker, comment := splitComment(value[2:])
+				start := i
+				var body []string
+				for i++; i < len(lines) && strings.TrimSpace(lines[i]) != marker; i++ {
+					body = append(body, lines[i])
+				}
+				if i == len(lines) {
+					i = start
+					return nil, fail(off, "missing %s at the end of the multi-line value", marker)
+				}
+				e.value, e.heredoc, e.comment = strings.Join(body, "\n"), marker, comment
+
+			default:
+				e.value, e.comment = splitComment(value)
+				for e.comment == "" && strings.HasSuffix(e.value, `\`) {
+					if i+1 == len(lines) {
+						return nil, fail(len(lines[i])-1, "line continuation at the end of the file")
+					}
+					i++
+					next, comment := splitComment(strings.TrimSpace(lines[i]))
+					e.value = e.value[:len(e.value)-1] + next
+					e.comment = comment
+				}
+			}
+			e.endLine = i + 1
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// column 返回 line 中字节位置 off 的列号
+func column(line string, off int) int {
+	if off > len(line) {
+		off = len(line)
+	}
+	if off < 0 {
+		off = 0
+	}
+	return utf8.RuneCountInString(line[:off]) + 1
+}
+
+// splitComment 把没有引号的值和后面的注释分开, 在开头或者空白之后的 # 开始注释
+func splitComment(s string) (value, comment string) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i:])
+		}
+	}
+	return strings.TrimSpace(s), ""
+}
+
+// isHeredoc 判断值是否是 <<MARKER, 标记由字母, 数字和下划线组成, 不以数字开头
+func isHeredoc(s string) bool {
+	if !strings.HasPrefix(s, "<<") {
+		return false
+	}
+	marker, _ := splitComment(s[2:])
+	if marker == "" || marker[0] >= '0' && marker[0] <= '9' {
+		return false
+	}
+	for _, r := range marker {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// unquoteConfig 解析 s 开头的带引号的值, 返回值和用掉的字节数. 出错时返回的字节数是出错的位置.
+func unquoteConfig(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 == len(s) {
+				return "", 0, fmt.Errorf("unterminated quoted value")
+			}
+			i++
+			switch s[i] {
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				return "", i - 1, fmt.Errorf("invalid escape \\%c", s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted value")
+}
+
+// formatValue 把值写成 lexConfig 能原样读回的形式: 需要时加上引号并转义,
+// 原来是多行的值 (heredoc 不为空) 时尽量保持多行的写法
+func formatValue(value string, quoted bool, heredoc string) string {
+	if heredoc != "" && !strings.Contains(value, "\r") {
+		ok := true
+		for _, line := range strings.Split(value, "\n") {
+			if strings.TrimSpace(line) == heredoc {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return "<<" + heredoc + "\n" + value + "\n" + heredoc
+		}
+	}
+
+	if !quoted && !needsQuote(value) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(value) + `"`
+}
+
+// needsQuote 判断没有引号的值是否会被读成别的内容
+func needsQuote(value string) bool {
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "\n\r") {
+		return true
+	}
+	if strings.HasPrefix(value, `"`) || strings.HasSuffix(value, `\`) || isHeredoc(value) {
+		return true
+	}
+	v, comment := splitComment(value)
+	return comment != "" || v != value
+}
@@ -0,0 +1,196 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLexConfigValues(t *testing.T) {
+	src := `# comment
+plain = hello world   # trailing comment
+hash = a#b
+color = "#fff"
+quoted = "say \"hi\" # not a comment\n"
+empty = ""
+bare =
+list = alice, \
+       bob, \
+       carol # admins
+text = <<EOF
+  first line
+# not a comment
+EOF
+crlf = yes` + "\r\n" + `[db]   # section comment
+host = 127.0.0.1
+`
+
+	entries, err := lexConfig("app.conf", src)
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+
+	want := map[string]string{
+		"plain":  "hello world",
+		"hash":   "a#b",
+		"color":  "#fff",
+		"quoted": `say "hi" # not a comment` + "\n",
+		"empty":  "",
+		"bare":   "",
+		"list":   "alice, bob, carol",
+		"text":   "  first line\n# not a comment",
+		"crlf":   "yes",
+		"host":   "127.0.0.1",
+	}
+	got := map[string]string{}
+	for _, e := range entries {
+		if e.kind == configKey {
+			got[e.name] = e.value
+		}
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("bad %s: got %q, want %q", key, got[key], value)
+		}
+	}
+
+	// 条目按顺序覆盖所有的行
+	line := 1
+	for _, e := range entries {
+		if e.line != line || e.endLine < e.line {
+			t.Fatalf("bad entry lines: got %d-%d, want start %d", e.line, e.endLine, line)
+		}
+		line = e.endLine + 1
+	}
+	if line != strings.Count(src, "\n")+1 {
+		t.Fatalf("bad line count: got %d", line-1)
+	}
+}
+
+func TestLexConfigErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		line   int
+		column int
+		msg    string
+	}{
+		{"a = 1\nno equal sign\n", 2, 14, `expected = after key "no equal sign"`},
+		{"  = 1\n", 1, 3, "missing key before ="},
+		{"[db\n", 1, 4, "missing ] in section header"},
+		{"[ ]\n", 1, 1, "empty section name"},
+		{"[db] x\n", 1, 6, `unexpected "x" after section header`},
+		{"a = \"open\n", 1, 5, "unterminated quoted value"},
+		{"a = \"x\" y\n", 1, 9, `unexpected "y" after quoted value`},
+		{"a = \"\\q\"\n", 1, 6, `invalid escape \q`},
+		{"名字 = \"\\q\"\n", 1, 7, `invalid escape \q`},
+		{"a = 1\nb = <<END\ntext\n", 2, 5, "missing END at the end of the multi-line value"},
+		{"a = x \\\n", 1, 7, "line continuation at the end of the file"},
+		{"a\"b = 1\n", 1, 2, `invalid character '"' in key`},
+		{"include\n", 1, 8, `expected = after key "include"`},
+	}
+
+	for i, tt := range tests {
+		_, err := lexConfig("app.conf", tt.src)
+		ce, ok := err.(*ConfigError)
+		if !ok {
+			t.Fatalf("%v: bad error: got %T %v", i+1, err, err)
+		}
+		if ce.File != "app.conf" || ce.Line != tt.line || ce.Column != tt.column || ce.Msg != tt.msg {
+			t.Fatalf("%v: bad error: got %d:%d %q, want %d:%d %q", i+1, ce.Line, ce.Column, ce.Msg, tt.line, tt.column, tt.msg)
+		}
+	}
+}
+
+func TestConfigSaveSyntax(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": "title = Blog # site title\nmotd = <<EOF\nhello\nEOF\nlist = a, \\\n  b\nnote = \"x\"\nkeep = 1\n",
+	})
+	file := filepath.Join(dir, "app.conf")
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	cfg.Set("title", "My # Blog")
+	cfg.Set("motd", "hello\nworld")
+	cfg.Set("list", "c")
+	cfg.Set("note", "a \"quote\"")
+	cfg.Set("added", "line1\nline2")
+	if err := cfg.SaveConfigFile(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	b, _ := os.ReadFile(file)
+	want := "title = \"My # Blog\" # site title\nmotd = <<EOF\nhello\nworld\nEOF\nlist = c\nnote = \"a \\\"quote\\\"\"\nkeep = 1\nadded = \"line1\\nline2\"\n"
+	if string(b) != want {
+		t.Fatalf("bad file:\n%q\nwant:\n%q", b, want)
+	}
+
+	reloaded, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	for _, key := range []string{"title", "motd", "list", "note", "keep", "added"} {
+		if got, want := reloaded.String(key), cfg.String(key); got != want {
+			t.Fatalf("bad %s after reload: got %q, want %q", key, got, want)
+		}
+	}
+	if got, want := cfg.Source("keep"), file+":8"; got != want {
+		t.Fatalf("bad source: got %q, want %q", got, want)
+	}
+}
+
+func FuzzLexConfig(f *testing.F) {
+	seeds := []string{
+		"",
+		"a = 1\n",
+		"# c\n[db]\nhost = x # y\n",
+		"q = \"a\\\"b\\n\" # c\n",
+		"h = <<EOF\nx\n  EOF\n",
+		"l = a \\\n b\n",
+		"include other.conf\n",
+		"[db\n",
+		"a = \"\\",
+		"k = <<EOF",
+		"名字 = 值\r\n",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		entries, err := lexConfig("fuzz.conf", src)
+		if err != nil {
+			ce, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("bad error type: %T %v", err, err)
+			}
+			if ce.Line < 1 || ce.Line > strings.Count(src, "\n")+1 || ce.Column < 1 {
+				t.Fatalf("bad error position: %v", ce)
+			}
+			return
+		}
+
+		line := 1
+		for _, e := range entries {
+			if e.line != line || e.endLine < e.line {
+				t.Fatalf("bad entry lines: got %d-%d, want start %d", e.line, e.endLine, line)
+			}
+			line = e.endLine + 1
+
+			if e.kind != configKey {
+				continue
+			}
+
+			// 写回的值能原样读回
+			for _, heredoc := range []string{"", "EOF"} {
+				out := "k = " + formatValue(e.value, e.quoted, heredoc) + "\n"
+				again, err := lexConfig("fuzz.conf", out)
+				if err != nil || len(again) != 1 || again[0].value != e.value {
+					t.Fatalf("value %q does not round trip through %q: %v %+v", e.value, out, err, again)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,220 @@
+// 分层配置
+// 配置可以来自多个 ConfigProvider, 按优先级从低到高合并, 后面的覆盖前面的:
+//
+//	cfg, err := LoadLayeredConfig(
+//		NewMapProvider("defaults", map[string]string{"addr": ":8080", "http.timeout": "30s"}),
+//		NewFileProvider("conf/app.conf"), // 按扩展名选择 INI, JSON, TOML 或 YAML
+//		NewEnvProvider("BLOG_"),          // BLOG_ADDR, BLOG_HTTP_TIMEOUT
+//		NewFlagProvider(flag.CommandLine), // -addr=:80, 只取命令行中出现了的参数
+//	)
+//	cfg.Source("addr") // "flag -addr"
+//
+// 合并之后的配置和 LoadConfig 得到的一样使用, Source 返回每个值来自哪里.
+package framework
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigProvider 提供一层配置
+type ConfigProvider interface {
+	// Load 读取这一层的配置. base 是优先级更低的各层合并之后的配置, 只读,
+	// 环境变量和命令行参数按其中已有的键查找对应的名字.
+	Load(base *Config) (*Config, error)
+}
+
+// LoadLayeredConfig 依次加载 providers 并合并, 后面的 provider 优先级更高.
+// Reload 和 WatchConfig 同样会重新加载所有的 provider.
+func LoadLayeredConfig(providers ...ConfigProvider) (*Config, error) {
+	cfg := &Config{}
+	for _, p := range providers {
+		layer, err := p.Load(cfg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.merge(layer)
+	}
+
+	cfg.providers = providers
+	return cfg, nil
+}
+
+// merge 把 layer 中的值合并进来, 覆盖已有的值
+func (c *Config) merge(layer *Config) {
+	for _, section := range layer.sections {
+		for key, value := range layer.data[section] {
+			c.put(section, key, value, layer.pos[section][key])
+		}
+	}
+	c.files = append(c.files, layer.files...)
+	c.runMode = c.data[DefaultSection]["runmode"]
+}
+
+// put 设置 section 中 key 的值和来源
+func (c *Config) put(section, key, value, pos string) {
+	c.addSection(section)
+	c.data[section][key] = value
+	c.pos[section][key] = pos
+}
+
+// Source 返回 key 的值来自哪里: 文件名:行号, 环境变量, 命令行参数或者 provider 的名字, key 不存在时返回空字符串
+func (c *Config) Source(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.position(key)
+}
+
+// resolve 返回 key 在 base 中对应的 段, 键: 已有的键按查找的规则, 否则按 key 的写法
+func (c *Config) resolve(key string) (string, string) {
+	if section, name, ok := c.locate(key); ok {
+		return section, name
+	}
+	k := splitKey(key)[0]
+	return k[0], k[1]
+}
+
+// logicalKeys 返回 base 中所有的键, 写成 section.key 的形式, 运行模式段中的覆盖按被覆盖的键计算
+func (c *Config) logicalKeys() []string {
+	var keys []string
+	for _, section := range c.sections {
+		for key := range c.data[section] {
+			switch {
+			case section == DefaultSection:
+			case c.runMode != "" && section == c.runMode:
+			case c.runMode != "" && strings.HasPrefix(section, c.runMode+"."):
+				key = section[len(c.runMode)+1:] + "." + key
+			default:
+				key = section + "." + key
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+type fileProvider struct {
+	filename string
+	parse    func(filename string) (*Config, error)
+}
+
+func (p *fileProvider) Load(base *Config) (*Config, error) {
+	return p.parse(p.filename)
+}
+
+// NewINIProvider 读取 LoadConfig 格式的文件, 支持段, include 和 ${ENV}
+func NewINIProvider(filename string) ConfigProvider {
+	return &fileProvider{filename, LoadConfig}
+}
+
+// NewJSONProvider 读取 JSON 文件, 嵌套的对象对应段, 数组写成逗号分隔的值
+func NewJSONProvider(filename string) ConfigProvider {
+	return &fileProvider{filename, parseJSONConfig}
+}
+
+// NewTOMLProvider 读取 TOML 文件, 支持表, 点分隔的键, 字符串, 数字, 布尔值和单行数组
+func NewTOMLProvider(filename string) ConfigProvider {
+	return &fileProvider{filename, parseTOMLConfig}
+}
+
+// NewYAMLProvider 读取 YAML 文件, 支持嵌套的映射, 标量和标量的列表
+func NewYAMLProvider(filename string) ConfigProvider {
+	return &fileProvider{filename, parseYAMLConfig}
+}
+
+// NewFileProvider 按扩展名选择格式: .json, .toml, .yaml 和 .yml, 其他的按 INI 读取
+func NewFileProvider(filename string) ConfigProvider {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return NewJSONProvider(filename)
+	case ".toml":
+		return NewTOMLProvider(filename)
+	case ".yaml", ".yml":
+		return NewYAMLProvider(filename)
+	}
+	return NewINIProvider(filename)
+}
+
+type envProvider struct {
+	prefix string
+}
+
+// NewEnvProvider 从以 prefix 开头的环境变量读取配置. 已有的键 db.host 对应 prefix + DB_HOST,
+// . 和 - 换成 _, 都换成大写. 其他以 prefix 开头的变量按小写, _ 换成 . 加到默认段, 例如 BLOG_HTTP_PORT 是 http.port.
+// 解密用的 BLOG_SECRET_KEY 和 BLOG_SECRET_KEY_FILE 不会读进配置.
+func NewEnvProvider(prefix string) ConfigProvider {
+	return &envProvider{prefix}
+}
+
+func (p *envProvider) Load(base *Config) (*Config, error) {
+	layer := &Config{}
+	known := map[string]bool{}
+
+	for _, key := range base.logicalKeys() {
+		name := p.prefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+		known[name] = true
+		if isSecretKeyEnv(name) {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			section, key := base.resolve(key)
+			layer.put(section, key, value, "env "+name)
+		}
+	}
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, p.prefix) || known[name] || name == p.prefix || isSecretKeyEnv(name) {
+			continue
+		}
+		key := strings.ReplaceAll(strings.ToLower(name[len(p.prefix):]), "_", ".")
+		layer.put(DefaultSection, key, value, "env "+name)
+	}
+
+	return layer, nil
+}
+
+// isSecretKeyEnv 判断环境变量是否保存了解密配置用的密钥
+func isSecretKeyEnv(name string) bool {
+	return name == SecretKeyEnv || name == SecretKeyFileEnv
+}
+
+type flagProvider struct {
+	fs *flag.FlagSet
+}
+
+// NewFlagProvider 从命令行参数读取配置, 参数名就是键, 例如 -db.host. 只取命令行中出现了的参数,
+// 参数的默认值不会覆盖其他层的配置. fs 需要已经 Parse 过.
+func NewFlagProvider(fs *flag.FlagSet) ConfigProvider {
+	return &flagProvider{fs}
+}
+
+func (p *flagProvider) Load(base *Config) (*Config, error) {
+	layer := &Config{}
+	p.fs.Visit(func(f *flag.Flag) {
+		section, key := base.resolve(f.Name)
+		layer.put(section, key, f.Value.String(), "flag -"+f.Name)
+	})
+	return layer, nil
+}
+
+type mapProvider struct {
+	name   string
+	values map[string]string
+}
+
+// NewMapProvider 用 values 提供配置, 键的写法同 String, 通常作为优先级最低的默认值. name 是 Source 返回的来源.
+func NewMapProvider(name string, values map[string]string) ConfigProvider {
+	return &mapProvider{name, values}
+}
+
+func (p *mapProvider) Load(base *Config) (*Config, error) {
+	layer := &Config{}
+	for key, value := range p.values {
+		section, key := base.resolve(key)
+		layer.put(section, key, value, p.name)
+	}
+	return layer, nil
+}
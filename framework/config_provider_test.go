@@ -0,0 +1,201 @@
+package framework
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigFormats(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": `title = My Blog
+debug = true
+tags = go,web
+[db]
+host = 127.0.0.1
+port = 3306
+[db.replica]
+host = 127.0.0.2
+`,
+		"app.json": `{"title": "My Blog", "debug": true, "tags": ["go", "web"],
+  "db": {"host": "127.0.0.1", "port": 3306, "replica": {"host": "127.0.0.2"}}}`,
+		"app.toml": `title = "My Blog" # comment
+debug = true
+tags = ["go", 'web']
+
+[db]
+host = "127.0.0.1"
+port = 3306
+replica.host = "127.0.0.2"
+`,
+		"app.yaml": `# comment
+title: "My Blog"
+debug: true
+tags:
+  - go
+  - web
+db:
+  host: 127.0.0.1   # comment
+  port: 3306
+  replica:
+    host: '127.0.0.2'
+`,
+	})
+
+	want := map[string]string{
+		"title":           "My Blog",
+		"debug":           "true",
+		"tags":            "go,web",
+		"db.host":         "127.0.0.1",
+		"db.port":         "3306",
+		"db.replica.host": "127.0.0.2",
+	}
+
+	for _, name := range []string{"app.conf", "app.json", "app.toml", "app.yaml"} {
+		cfg, err := LoadLayeredConfig(NewFileProvider(filepath.Join(dir, name)))
+		if err != nil {
+			t.Fatalf("%s: load: %v", name, err)
+		}
+		for key, value := range want {
+			if got := cfg.String(key); got != value {
+				t.Fatalf("%s: bad %s: got %q, want %q", name, key, got, value)
+			}
+		}
+		if got := cfg.Section("db.replica"); !reflect.DeepEqual(got, map[string]string{"host": "127.0.0.2"}) {
+			t.Fatalf("%s: bad section: got %v", name, got)
+		}
+	}
+
+	cfg, _ := LoadLayeredConfig(NewYAMLProvider(filepath.Join(dir, "app.yaml")))
+	if got, want := cfg.Source("db.port"), filepath.Join(dir, "app.yaml")+":9"; got != want {
+		t.Fatalf("bad source: got %q, want %q", got, want)
+	}
+}
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		line, want string
+	}{
+		{"title: it's # note", "title: it's "},
+		{"tagline: rock 'n' roll # note", "tagline: rock 'n' roll "},
+		{"title: 'a # b' # note", "title: 'a # b' "},
+		{`title: "it's # here" # note`, `title: "it's # here" `},
+		{"  - 'x # y' # note", "  - 'x # y' "},
+		{`tags = ["a # b", 'c'] # note`, `tags = ["a # b", 'c'] `},
+		{`"a # b" = 1 # note`, `"a # b" = 1 `},
+		{"color: #fff", "color: "},
+		{"url: http://x/#top", "url: http://x/#top"},
+	}
+	for i, v := range tests {
+		if got := stripComment(v.line); got != v.want {
+			t.Fatalf("%v: bad line: got %q, want %q", i+1, got, v.want)
+		}
+	}
+}
+
+func TestConfigFormatErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"a.toml", "title = \"x\"\n[[posts]]\n", "a.toml:2: arrays of tables are not supported"},
+		{"a.toml", "db = {host = 1}\n", "a.toml:1: inline tables are not supported"},
+		{"a.toml", "title\n", "a.toml:1: expected key = value"},
+		{"a.toml", "title = \"x\n", "a.toml:1: invalid string"},
+		{"a.yaml", "a:\n  - x\n  b: 1\n", "a.yaml:3: mapping inside a list"},
+		{"a.yaml", "a: |\n  text\n", "a.yaml:1: block scalars are not supported"},
+		{"a.yaml", "- x\n", "a.yaml:1: list item without a key"},
+		{"a.yaml", "a: {b: 1}\n", "a.yaml:1: flow mappings are not supported"},
+		{"a.json", `{"a": [{"b": 1}]}`, "a.json: a: arrays can only contain scalars"},
+		{"a.json", `{"a": }`, "a.json: invalid character"},
+	}
+
+	for i, tt := range tests {
+		dir := writeConfigFiles(t, map[string]string{tt.name: tt.content})
+		_, err := LoadLayeredConfig(NewFileProvider(filepath.Join(dir, tt.name)))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%v: bad error: got %v, want %q", i+1, err, tt.err)
+		}
+	}
+}
+
+func TestLayeredConfig(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": "runmode = prod\naddr = :8080\nsession_cookie = sid\n[db]\nhost = 127.0.0.1\nport = 3306\n[prod]\ndb.host = db.internal\n",
+	})
+	file := filepath.Join(dir, "app.conf")
+
+	t.Setenv("BLOG_DB_HOST", "env-db")
+	t.Setenv("BLOG_SESSION_COOKIE", "env-sid")
+	t.Setenv("BLOG_HTTP_PORT", "9000")
+	t.Setenv(SecretKeyEnv, "master-key")
+	t.Setenv(SecretKeyFileEnv, "master.key")
+
+	fs := flag.NewFlagSet("blog", flag.ContinueOnError)
+	fs.String("addr", ":1", "")
+	fs.String("db.port", "1", "")
+	fs.String("title", "default title", "")
+	if err := fs.Parse([]string{"-addr=:80"}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	cfg, err := LoadLayeredConfig(
+		NewMapProvider("defaults", map[string]string{"addr": ":3000", "db.port": "5432", "db.name": "blog", "title": "Blog"}),
+		NewINIProvider(file),
+		NewEnvProvider("BLOG_"),
+		NewFlagProvider(fs),
+	)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		source string
+	}{
+		{"addr", ":80", "flag -addr"},
+		{"db.host", "env-db", "env BLOG_DB_HOST"},
+		{"db.port", "3306", file + ":6"},
+		{"db.name", "blog", "defaults"},
+		{"title", "Blog", "defaults"},
+		{"session_cookie", "env-sid", "env BLOG_SESSION_COOKIE"},
+		{"http.port", "9000", "env BLOG_HTTP_PORT"},
+		{"missing", "", ""},
+		{"secret.key", "", ""},
+		{"secret.key.file", "", ""},
+	}
+	for i, tt := range tests {
+		if got := cfg.String(tt.key); got != tt.value {
+			t.Fatalf("%v: bad %s: got %q, want %q", i+1, tt.key, got, tt.value)
+		}
+		if got := cfg.Source(tt.key); got != tt.source {
+			t.Fatalf("%v: bad source of %s: got %q, want %q", i+1, tt.key, got, tt.source)
+		}
+	}
+
+	for key := range cfg.Section(DefaultSection) {
+		if strings.HasPrefix(key, "secret.") {
+			t.Fatalf("secret key env imported as %s", key)
+		}
+	}
+	if got := cfg.Section("db")["name"]; got != "blog" {
+		t.Fatalf("bad db section: got %v", cfg.Section("db"))
+	}
+
+	// Reload 重新加载所有的层
+	os.WriteFile(file, []byte("addr = :8080\n[db]\nport = 3307\n"), 0644)
+	if err := cfg.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := cfg.String("db.port"); got != "3307" {
+		t.Fatalf("bad port after reload: got %q", got)
+	}
+	if got := cfg.String("addr"); got != ":80" {
+		t.Fatalf("bad addr after reload: got %q", got)
+	}
+}
@@ -0,0 +1,272 @@
+// 加密的配置
+// 以 enc: 开头的值是用 AES-256-GCM 加密的, 读取时自动解密, 配置文件可以提交到仓库:
+//
+//	[session]
+//	hash_key = enc:3q2+7wAAAAAAAAAA...
+//
+// 密钥是 base64 编码的 32 字节, 来自环境变量 BLOG_SECRET_KEY, 或者 BLOG_SECRET_KEY_FILE 指定的文件,
+// 也可以用 SetSecretKey 设置. 环境变量在第一次解密时读取, Reload 时重新读取. 用 blogctl config 加密, 解密和更换密钥.
+package framework
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// SecretKeyEnv 是保存密钥的环境变量
+	SecretKeyEnv = "BLOG_SECRET_KEY"
+	// SecretKeyFileEnv 是保存密钥文件路径的环境变量, 没有设置 SecretKeyEnv 时使用
+	SecretKeyFileEnv = "BLOG_SECRET_KEY_FILE"
+
+	secretPrefix = "enc:"
+)
+
+// NewSecretKey 生成一个随机的密钥, base64 编码
+func NewSecretKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseSecretKey 解析 base64 编码的 32 字节密钥
+func ParseSecretKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("config: secret key must be 32 bytes, base64 encoded")
+	}
+	return key, nil
+}
+
+// LoadSecretKey 从环境变量 BLOG_SECRET_KEY 或者 BLOG_SECRET_KEY_FILE 指定的文件读取密钥
+func LoadSecretKey() ([]byte, error) {
+	if s := os.Getenv(SecretKeyEnv); s != "" {
+		return ParseSecretKey(s)
+	}
+	if file := os.Getenv(SecretKeyFileEnv); file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return ParseSecretKey(string(b))
+	}
+	return nil, fmt.Errorf("config: no secret key, set %s or %s", SecretKeyEnv, SecretKeyFileEnv)
+}
+
+// IsEncrypted 判断值是否是加密的
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// EncryptSecret 用 key 加密 plaintext, 返回 enc: 开头的值. 每次加密使用随机的 nonce, 结果都不一样.
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret 用 key 解密 EncryptSecret 返回的值
+func DecryptSecret(key []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", errors.New("config: value is not encrypted")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(value[len(secretPrefix):])
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("config: malformed encrypted value")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("config: cannot decrypt value, wrong secret key?")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("config: bad secret key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretCache 缓存从环境变量读取的密钥, 第一次用到时读取一次, Reload 时重新读取
+type secretCache struct {
+	once   sync.Once
+	key    []byte
+	err    error
+	warned sync.Map // key: 已经记录过解密失败的键
+}
+
+// SetSecretKey 设置解密用的密钥, 没有设置时从环境变量读取, 见 LoadSecretKey
+func (c *Config) SetSecretKey(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.secretKey = key
+	c.secrets = secretCache{}
+}
+
+// secret 返回解密用的密钥, 调用者需要持有锁
+func (c *Config) secret() ([]byte, error) {
+	if c.secretKey != nil {
+		return c.secretKey, nil
+	}
+	c.secrets.once.Do(func() {
+		c.secrets.key, c.secrets.err = LoadSecretKey()
+	})
+	return c.secrets.key, c.secrets.err
+}
+
+// decrypt 解密加密的值, 失败时返回空字符串, 每个键只记录一次日志. 调用者需要持有锁.
+func (c *Config) decrypt(key, value string) string {
+	if !IsEncrypted(value) {
+		return value
+	}
+
+	secret, err := c.secret()
+	if err == nil {
+		value, err = DecryptSecret(secret, value)
+	}
+	if err != nil {
+		if _, warned := c.secrets.warned.LoadOrStore(key, true); !warned {
+			log.Printf("config: %s: %v", key, err)
+		}
+		return ""
+	}
+	return value
+}
+
+// Secret 同 String, 解密失败时返回错误而不是空字符串
+func (c *Config) Secret(key string) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	section, name, ok := c.locate(key)
+	if !ok {
+		return "", fmt.Errorf("config: %s is not set", key)
+	}
+
+	value := c.data[section][name]
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	secret, err := c.secret()
+	if err != nil {
+		return "", err
+	}
+	value, err = DecryptSecret(secret, value)
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, key)
+	}
+	return value, nil
+}
+
+// Encrypt 用 secret 加密 key 的值, 已经加密的值不变. 用 SaveConfigFile 保存.
+func (c *Config) Encrypt(key string, secret []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	section, name, ok := c.locate(key)
+	if !ok {
+		return fmt.Errorf("config: %s is not set", key)
+	}
+
+	value := c.data[section][name]
+	if IsEncrypted(value) {
+		return nil
+	}
+	value, err := EncryptSecret(secret, value)
+	if err != nil {
+		return err
+	}
+
+	c.data[section][name] = value
+	c.markEdited(section, name)
+	return nil
+}
+
+// Decrypt 用 secret 解密 key 的值, 以明文保存在配置中. 用 SaveConfigFile 保存.
+func (c *Config) Decrypt(key string, secret []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	section, name, ok := c.locate(key)
+	if !ok {
+		return fmt.Errorf("config: %s is not set", key)
+	}
+
+	value := c.data[section][name]
+	if !IsEncrypted(value) {
+		return nil
+	}
+	value, err := DecryptSecret(secret, value)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, key)
+	}
+
+	c.data[section][name] = value
+	c.markEdited(section, name)
+	return nil
+}
+
+// RotateSecrets 用 oldKey 解密所有加密的值, 再用 newKey 加密, 返回更换了的值的个数. 用 SaveConfigFile 保存.
+// 有任何一个值解密失败时不做修改.
+func (c *Config) RotateSecrets(oldKey, newKey []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type secretValue struct{ section, name, value string }
+	var rotated []secretValue
+	for _, section := range c.sections {
+		for name, value := range c.data[section] {
+			if !IsEncrypted(value) {
+				continue
+			}
+
+			plaintext, err := DecryptSecret(oldKey, value)
+			if err != nil {
+				return 0, fmt.Errorf("%v: %s::%s", err, section, name)
+			}
+			value, err := EncryptSecret(newKey, plaintext)
+			if err != nil {
+				return 0, err
+			}
+			rotated = append(rotated, secretValue{section, name, value})
+		}
+	}
+
+	for _, s := range rotated {
+		c.data[s.section][s.name] = s.value
+		c.markEdited(s.section, s.name)
+	}
+	if c.secretKey != nil {
+		c.secretKey = newKey
+	}
+	c.secrets = secretCache{}
+	return len(rotated), nil
+}
@@ -0,0 +1,143 @@
+package framework
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testSecretKey(t *testing.T) []byte {
+	s, err := NewSecretKey()
+	if err != nil {
+		t.Fatalf("new key: %v", err)
+	}
+	key, err := ParseSecretKey(s)
+	if err != nil {
+		t.Fatalf("parse key: %v", err)
+	}
+	return key
+}
+
+func TestSecretRoundTrip(t *testing.T) {
+	key, other := testSecretKey(t), testSecretKey(t)
+
+	for i, plaintext := range []string{"", "hunter2", "多行\n的值 # x"} {
+		value, err := EncryptSecret(key, plaintext)
+		if err != nil {
+			t.Fatalf("%v: encrypt: %v", i+1, err)
+		}
+		if !IsEncrypted(value) || strings.Contains(value, "\n") {
+			t.Fatalf("%v: bad encrypted value: got %q", i+1, value)
+		}
+		again, _ := EncryptSecret(key, plaintext)
+		if again == value {
+			t.Fatalf("%v: nonce reused: %q", i+1, value)
+		}
+
+		if got, err := DecryptSecret(key, value); err != nil || got != plaintext {
+			t.Fatalf("%v: bad plaintext: got %q, %v, want %q", i+1, got, err, plaintext)
+		}
+		if _, err := DecryptSecret(other, value); err == nil {
+			t.Fatalf("%v: decrypted with the wrong key", i+1)
+		}
+	}
+
+	for i, value := range []string{"plain", "enc:", "enc:!!!", "enc:AAAA"} {
+		if _, err := DecryptSecret(key, value); err == nil {
+			t.Fatalf("%v: no error for %q", i+1, value)
+		}
+	}
+	if _, err := ParseSecretKey("c2hvcnQ="); err == nil {
+		t.Fatalf("no error for a short key")
+	}
+}
+
+func TestConfigSecrets(t *testing.T) {
+	key := testSecretKey(t)
+	password, _ := EncryptSecret(key, "hunter2")
+	token, _ := EncryptSecret(key, "abc")
+
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": "user = admin\ntoken = " + token + "\n[db]\npassword = " + password + " # secret\n",
+	})
+	file := filepath.Join(dir, "app.conf")
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// 从环境变量读取密钥, 读取一次之后缓存, Reload 时重新读取
+	t.Setenv(SecretKeyEnv, "")
+	t.Setenv(SecretKeyFileEnv, "")
+	if got := cfg.String("db.password"); got != "" {
+		t.Fatalf("decrypted without a key: got %q", got)
+	}
+	if _, err := cfg.Secret("db.password"); err == nil {
+		t.Fatalf("no error without a key")
+	}
+	keyFile := filepath.Join(dir, "master.key")
+	os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	t.Setenv(SecretKeyFileEnv, keyFile)
+	if got := cfg.String("db.password"); got != "" {
+		t.Fatalf("secret key not cached: got %q", got)
+	}
+	if err := cfg.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := cfg.String("db.password"); got != "hunter2" {
+		t.Fatalf("bad password: got %q, want %q", got, "hunter2")
+	}
+	if got := cfg.Section("db")["password"]; got != "hunter2" {
+		t.Fatalf("bad section value: got %q, want %q", got, "hunter2")
+	}
+
+	// 加密, 保存之后只有密文
+	cfg.SetSecretKey(key)
+	if err := cfg.Encrypt("user", key); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if err := cfg.SaveConfigFile(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	b, _ := os.ReadFile(file)
+	if strings.Contains(string(b), "admin") || strings.Contains(string(b), "hunter2") || !strings.Contains(string(b), " # secret\n") {
+		t.Fatalf("bad file:\n%s", b)
+	}
+
+	// 更换密钥之后用新的密钥读取
+	newKey := testSecretKey(t)
+	n, err := cfg.RotateSecrets(key, newKey)
+	if err != nil || n != 3 {
+		t.Fatalf("bad rotate: got %d, %v, want 3", n, err)
+	}
+	if err := cfg.SaveConfigFile(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	reloaded, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	reloaded.SetSecretKey(newKey)
+	for key, want := range map[string]string{"user": "admin", "token": "abc", "db.password": "hunter2"} {
+		if got, err := reloaded.Secret(key); err != nil || got != want {
+			t.Fatalf("bad %s after rotate: got %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if _, err := reloaded.RotateSecrets(key, newKey); err == nil {
+		t.Fatalf("rotated with the wrong key")
+	}
+
+	// 解密之后以明文保存
+	if err := reloaded.Decrypt("token", newKey); err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if err := reloaded.SaveConfigFile(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	b, _ = os.ReadFile(file)
+	if !strings.Contains(string(b), "token = abc\n") {
+		t.Fatalf("bad file after decrypt:\n%s", b)
+	}
+}
@@ -0,0 +1,488 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestConfigSections(t *testing.T) {
+	t.Setenv("BLOG_TEST_RUNMODE", "prod")
+	t.Setenv("BLOG_TEST_DB_USER", "blog")
+
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": `# 应用
+appname = blog
+runmode = ${BLOG_TEST_RUNMODE||dev}
+addr = :8080
+include conf.d/secrets.conf
+
+# 数据库
+[db]
+host = 127.0.0.1
+port = 3306
+user = ${BLOG_TEST_DB_USER}
+password = ${BLOG_TEST_MISSING||secret}
+
+[db.replica]
+host = 127.0.0.2
+
+[prod]
+addr = :80
+db.host = db.internal
+
+[prod.db.replica]
+host = replica.internal
+`,
+		"conf.d/secrets.conf": "hash_key = abc\n[mail]\nhost = smtp\n",
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "app.conf"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.RunMode() != "prod" {
+		t.Fatalf("bad run mode: got %q, want %q", cfg.RunMode(), "prod")
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"appname", "blog"},
+		{"addr", ":80"},
+		{"hash_key", "abc"},
+		{"mail::host", "smtp"},
+		{"db::host", "db.internal"},
+		{"db.host", "db.internal"},
+		{"db.port", "3306"},
+		{"db::user", "blog"},
+		{"db::password", "secret"},
+		{"db.replica.host", "replica.internal"},
+		{"db.replica::host", "replica.internal"},
+		{"default::appname", "blog"},
+		{"db::missing", ""},
+	}
+	for i, tt := range tests {
+		if got := cfg.String(tt.key); got != tt.want {
+			t.Fatalf("%v: bad %s: got %q, want %q", i+1, tt.key, got, tt.want)
+		}
+	}
+
+	if port, err := cfg.Int("db.port"); err != nil || port != 3306 {
+		t.Fatalf("bad port: got %d, %v", port, err)
+	}
+
+	want := map[string]string{"host": "db.internal", "port": "3306", "user": "blog", "password": "secret"}
+	if got := cfg.Section("db"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad section: got %v, want %v", got, want)
+	}
+	if got := cfg.Section("default")["addr"]; got != ":80" {
+		t.Fatalf("bad default section addr: got %q", got)
+	}
+	if _, ok := cfg.Section("default")["db.host"]; ok {
+		t.Fatalf("default section contains db.host override")
+	}
+	if cfg.Section("missing") != nil {
+		t.Fatalf("missing section: want nil")
+	}
+
+	wantSections := []string{"default", "mail", "db", "db.replica", "prod", "prod.db.replica"}
+	if got := cfg.Sections(); !reflect.DeepEqual(got, wantSections) {
+		t.Fatalf("bad sections: got %v, want %v", got, wantSections)
+	}
+
+	if got := cfg.comment["db"][0]; !reflect.DeepEqual(got, []string{"数据库\n", "host", "port", "user", "password"}) {
+		t.Fatalf("bad comment: got %q", got)
+	}
+	if _, ok := cfg.offset["db"]["host"]; !ok {
+		t.Fatalf("missing offset for db::host")
+	}
+	if _, ok := cfg.offset["default"]["hash_key"]; ok {
+		t.Fatalf("included key has an offset")
+	}
+}
+
+func TestConfigDevMode(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": "runmode = ${BLOG_TEST_UNSET_RUNMODE||dev}\naddr = :8080\n[prod]\naddr = :80\n[dev]\naddr = :3000\n",
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "app.conf"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := cfg.String("addr"); got != ":3000" {
+		t.Fatalf("bad addr: got %q, want %q", got, ":3000")
+	}
+}
+
+func TestConfigIncludeErrors(t *testing.T) {
+	tests := []struct {
+		files map[string]string
+		err   string
+	}{
+		{map[string]string{"app.conf": "include a.conf\n", "a.conf": "include app.conf\n"}, "include cycle"},
+		{map[string]string{"app.conf": "include missing.conf\n"}, "missing.conf"},
+		{map[string]string{"app.conf": "[ ]\n"}, "app.conf:1:1: empty section name"},
+	}
+
+	for i, tt := range tests {
+		dir := writeConfigFiles(t, tt.files)
+		_, err := LoadConfig(filepath.Join(dir, "app.conf"))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%v: bad error: got %v, want %q", i+1, err, tt.err)
+		}
+	}
+}
+
+func TestConfigSave(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": `# 站点
+title = "Old Blog"
+runmode = prod
+secret = ${BLOG_TEST_SECRET||dev}
+
+# 数据库
+[db]
+host   =  127.0.0.1
+port = 3306
+user = root
+
+[prod]
+db.port = 3307
+`,
+	})
+	file := filepath.Join(dir, "app.conf")
+	os.Chmod(file, 0600)
+
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	cfg.Set("title", "New # Blog")
+	cfg.Set("db.host", "db.internal")
+	cfg.Set("db.port", "4000")
+	cfg.Set("db::name", "blog")
+	cfg.Set("mail::host", "smtp")
+	cfg.Set("author", "hyl")
+	if !cfg.Delete("db.user") {
+		t.Fatalf("delete db.user: want true")
+	}
+	if cfg.Delete("db.missing") {
+		t.Fatalf("delete db.missing: want false")
+	}
+
+	if got := cfg.String("db.port"); got != "4000" {
+		t.Fatalf("bad port before save: got %q", got)
+	}
+
+	if err := cfg.SaveConfigFile(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	b, _ := os.ReadFile(file)
+	want := `# 站点
+title = "New # Blog"
+runmode = prod
+secret = ${BLOG_TEST_SECRET||dev}
+author = hyl
+
+# 数据库
+[db]
+host   =  db.internal
+port = 3306
+name = blog
+
+[prod]
+db.port = 4000
+
+[mail]
+host = smtp
+`
+	if string(b) != want {
+		t.Fatalf("bad file:\n%s\nwant:\n%s", b, want)
+	}
+	if info, _ := os.Stat(file); info.Mode().Perm() != 0600 {
+		t.Fatalf("bad mode: got %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	reloaded, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	for _, key := range []string{"title", "secret", "author", "db.host", "db.port", "db.name", "db.user", "mail.host"} {
+		if got, want := reloaded.String(key), cfg.String(key); got != want {
+			t.Fatalf("bad %s after reload: got %q, want %q", key, got, want)
+		}
+	}
+	if !reflect.DeepEqual(reloaded.offset, cfg.offset) {
+		t.Fatalf("bad offsets: got %v, want %v", cfg.offset, reloaded.offset)
+	}
+
+	// 没有修改时原样写回
+	if err := reloaded.SaveConfigFile(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if b2, _ := os.ReadFile(file); string(b2) != want {
+		t.Fatalf("bad unchanged file:\n%s", b2)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("temp files left: %v", entries)
+	}
+}
+
+func TestConfigSaveNew(t *testing.T) {
+	cfg := &Config{}
+	cfg.Set("addr", ":8080")
+	cfg.Set("db::host", " spaced ")
+
+	file := filepath.Join(t.TempDir(), "new.conf")
+	if err := cfg.SaveConfigFile(file); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	b, _ := os.ReadFile(file)
+	if want := "addr = :8080\n\n[db]\nhost = \" spaced \"\n"; string(b) != want {
+		t.Fatalf("bad file: got %q, want %q", b, want)
+	}
+}
+
+func TestConfigSaveDefaultKey(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"# database settings\n[db]\nhost = x\n", "newkey = v\n# database settings\n[db]\nhost = x\n"},
+		{"# blog\n\n# database settings\n[db]\nhost = x\n", "# blog\nnewkey = v\n\n# database settings\n[db]\nhost = x\n"},
+		{"[db]\nhost = x\n", "newkey = v\n[db]\nhost = x\n"},
+		{"addr = :80\n\n# database settings\n[db]\nhost = x\n", "addr = :80\nnewkey = v\n\n# database settings\n[db]\nhost = x\n"},
+	}
+	for i, v := range tests {
+		dir := writeConfigFiles(t, map[string]string{"app.conf": v.src})
+		file := filepath.Join(dir, "app.conf")
+		cfg, err := LoadConfig(file)
+		if err != nil {
+			t.Fatalf("%v: load: %v", i+1, err)
+		}
+
+		cfg.Set("newkey", "v")
+		if err := cfg.SaveConfigFile(file); err != nil {
+			t.Fatalf("%v: save: %v", i+1, err)
+		}
+		b, _ := os.ReadFile(file)
+		if string(b) != v.want {
+			t.Fatalf("%v: bad file: got %q, want %q", i+1, b, v.want)
+		}
+
+		reloaded, err := LoadConfig(file)
+		if err != nil {
+			t.Fatalf("%v: reload: %v", i+1, err)
+		}
+		if got := reloaded.String("newkey"); got != "v" {
+			t.Fatalf("%v: bad newkey: got %q, want %q", i+1, got, "v")
+		}
+		if got := reloaded.String("db.host"); got != "x" {
+			t.Fatalf("%v: bad db.host: got %q, want %q", i+1, got, "x")
+		}
+	}
+}
+
+func TestConfigWatch(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf":   "title = Old\nlog_level = info\ninclude extra.conf\n",
+		"extra.conf": "feature = off\n",
+	})
+
+	cfg, err := WatchConfig(filepath.Join(dir, "app.conf"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	defer cfg.StopWatch()
+
+	type change struct{ key, old, new string }
+	changes := make(chan change, 10)
+	for _, key := range []string{"title", "feature", "log_level"} {
+		key := key
+		cfg.OnChange(key, func(old, new string) { changes <- change{key, old, new} })
+	}
+
+	wait := func(want change) {
+		t.Helper()
+		select {
+		case got := <-changes:
+			if got != want {
+				t.Fatalf("bad change: got %+v, want %+v", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for %+v", want)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "app.conf"), []byte("title = New Blog\nlog_level = info\ninclude extra.conf\n"), 0644)
+	wait(change{"title", "Old", "New Blog"})
+
+	os.WriteFile(filepath.Join(dir, "extra.conf"), []byte("feature = on\n"), 0644)
+	wait(change{"feature", "off", "on"})
+
+	// 有错误的文件不替换原来的配置
+	os.WriteFile(filepath.Join(dir, "app.conf"), []byte("title = Broken\ninclude missing.conf\n"), 0644)
+	time.Sleep(100 * time.Millisecond)
+	if got := cfg.String("title"); got != "New Blog" {
+		t.Fatalf("bad title after broken reload: got %q", got)
+	}
+
+	cfg.Set("log_level", "debug")
+	wait(change{"log_level", "info", "debug"})
+
+	select {
+	case got := <-changes:
+		t.Fatalf("unexpected change: %+v", got)
+	default:
+	}
+}
+
+type testDBConfig struct {
+	Host     string `cfg:"host" required:"true"`
+	Port     int    `cfg:"port" default:"3306"`
+	Replicas []string
+}
+
+type testCommonConfig struct {
+	Debug bool `cfg:"debug"`
+}
+
+type testAppConfig struct {
+	testCommonConfig
+	Addr     string        `cfg:"addr" default:":8080"`
+	Timeout  time.Duration `cfg:"http.timeout" default:"30s"`
+	Idle     *time.Duration
+	Admins   []string      `cfg:"admins"`
+	Ports    []int         `cfg:"ports"`
+	Ratio    float64       `cfg:"ratio"`
+	Title    string        `cfg:"site::title"`
+	Ignored  string        `cfg:"-"`
+	DB       testDBConfig  `cfg:"db"`
+	Cache    *testDBConfig `cfg:"cache"`
+	internal string
+}
+
+func TestConfigUnmarshal(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": "debug = true\nadmins = alice, bob,\nports = 80,443\nidle = 90\nratio = 0.5\nignored = x\n[http]\ntimeout = 1m\n[site]\ntitle = Blog\n[db]\nhost = 127.0.0.1\nreplicas = a,b\n[cache]\nhost = redis\nport = 6379\n",
+	})
+	cfg, err := LoadConfig(filepath.Join(dir, "app.conf"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	var got testAppConfig
+	if err := cfg.Unmarshal(&got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	idle := 90 * time.Second
+	want := testAppConfig{
+		testCommonConfig: testCommonConfig{Debug: true},
+		Addr:             ":8080",
+		Timeout:          time.Minute,
+		Idle:             &idle,
+		Admins:           []string{"alice", "bob"},
+		Ports:            []int{80, 443},
+		Ratio:            0.5,
+		Title:            "Blog",
+		DB:               testDBConfig{Host: "127.0.0.1", Port: 3306, Replicas: []string{"a", "b"}},
+		Cache:            &testDBConfig{Host: "redis", Port: 6379},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad config:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestConfigUnmarshalErrors(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"app.conf": "# app\nports = 80,abc\nratio = half\n\n[http]\ntimeout = soon\n[cache]\nport = 6379\n",
+	})
+	file := filepath.Join(dir, "app.conf")
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	var got testAppConfig
+	err = cfg.Unmarshal(&got)
+	errs, ok := err.(ConfigFieldErrors)
+	if !ok {
+		t.Fatalf("bad error: got %T %v", err, err)
+	}
+
+	want := []string{
+		file + `:6: http.timeout must be a duration such as 30s or 1m30s, got "soon"`,
+		file + `:2: ports must be an integer, got "80,abc"`,
+		file + `:3: ratio must be a number, got "half"`,
+		`db.host is required`,
+		`cache.host is required`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("bad errors: got %v", errs)
+	}
+	for i, fe := range errs {
+		if fe.Error() != want[i] {
+			t.Fatalf("%v: bad error: got %q, want %q", i+1, fe.Error(), want[i])
+		}
+	}
+
+	if err := cfg.Unmarshal(got); err == nil {
+		t.Fatalf("unmarshal non-pointer: want error")
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg := loadTestConfig(t, "# server\naddr = 127.0.0.1:9000\nread_timeout = 5\nwrite_timeout = 1m30s\nhttp2 = false\nbad_duration = soon\n")
+
+	if got := cfg.DefaultString("addr", ":8080"); got != "127.0.0.1:9000" {
+		t.Fatalf("bad addr: got %q", got)
+	}
+	if got := cfg.DefaultString("missing", ":8080"); got != ":8080" {
+		t.Fatalf("bad default: got %q", got)
+	}
+
+	tests := []struct {
+		key  string
+		want time.Duration
+	}{
+		{"read_timeout", 5 * time.Second},
+		{"write_timeout", 90 * time.Second},
+		{"bad_duration", time.Minute},
+		{"missing", time.Minute},
+	}
+	for i, tt := range tests {
+		if got := cfg.DefaultDuration(tt.key, time.Minute); got != tt.want {
+			t.Fatalf("%v: bad duration: got %v, want %v", i+1, got, tt.want)
+		}
+	}
+
+	if cfg.DefaultBool("http2", true) {
+		t.Fatalf("bad http2: got true, want false")
+	}
+	if got := cfg.DefaultInt("addr", 42); got != 42 {
+		t.Fatalf("bad int: got %d, want %d", got, 42)
+	}
+}
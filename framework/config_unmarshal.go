@@ -0,0 +1,183 @@
+// 配置绑定到结构体
+// Unmarshal 按 tag 把配置填到结构体中, 一次检查所有的键:
+//
+//	type AppConfig struct {
+//		Addr    string        `cfg:"addr" default:":8080"`
+//		Timeout time.Duration `cfg:"http.timeout" default:"30s"`
+//		Admins  []string      `cfg:"admins"` // 逗号分隔
+//		DB      struct {
+//			Host string `cfg:"host" required:"true"`
+//			Port int    `cfg:"port" default:"3306"`
+//		} `cfg:"db"` // 嵌套的结构体对应段, 键为 db.host, db.port
+//	}
+//
+// 没有 cfg tag 的字段用小写的字段名, tag 为 "-" 的字段跳过, 含有 :: 的 tag 不加上层的前缀.
+// 配置中没有的键 (或者值为空) 使用 default, 也没有 default 时保持原值, required:"true" 的键必须有值.
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ConfigFieldError 是 Unmarshal 中一个键的错误
+type ConfigFieldError struct {
+	Key     string
+	Pos     string // 键所在的 文件名:行号, 配置中没有这个键时为空
+	Message string
+}
+
+func (e *ConfigFieldError) Error() string {
+	if e.Pos != "" {
+		return e.Pos + ": " + e.Key + " " + e.Message
+	}
+	return e.Key + " " + e.Message
+}
+
+// ConfigFieldErrors 是 Unmarshal 返回的所有缺少的和格式错误的键
+type ConfigFieldErrors []*ConfigFieldError
+
+func (e ConfigFieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return "config: " + strings.Join(msgs, "; ")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Unmarshal 把配置填到 v 中, v 是结构体指针. 有错误的键不影响其他键, 所有的错误以 ConfigFieldErrors 返回.
+func (c *Config) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Unmarshal needs a pointer to a struct")
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var errs ConfigFieldErrors
+	c.unmarshal(rv.Elem(), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Config) unmarshal(v reflect.Value, prefix string, errs *ConfigFieldErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("cfg")
+		if tag == "-" {
+			continue
+		}
+		fv := v.Field(i)
+
+		// 没有 tag 的嵌入结构体, 字段属于当前层
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			c.unmarshal(fv, prefix, errs)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		key := tag
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		if prefix != "" && !strings.Contains(key, "::") {
+			key = prefix + "." + key
+		}
+
+		if isConfigSection(f.Type) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(f.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			c.unmarshal(fv, key, errs)
+			continue
+		}
+
+		value, _ := c.value(key)
+		pos := c.position(key)
+		if value == "" {
+			def, ok := f.Tag.Lookup("default")
+			if !ok {
+				if f.Tag.Get("required") == "true" {
+					*errs = append(*errs, &ConfigFieldError{Key: key, Pos: pos, Message: "is required"})
+				}
+				continue
+			}
+			value, pos = def, ""
+		}
+
+		if err := setConfigValue(fv, value); err != nil {
+			*errs = append(*errs, &ConfigFieldError{Key: key, Pos: pos, Message: fmt.Sprintf("%v, got %q", err, value)})
+		}
+	}
+}
+
+// position 返回 key 所在的 文件名:行号, 调用者需要持有锁
+func (c *Config) position(key string) string {
+	section, name, ok := c.locate(key)
+	if !ok {
+		return ""
+	}
+	return c.pos[section][name]
+}
+
+// isConfigSection 判断 t 是否是对应一个段的结构体, time.Time 和实现了 TextUnmarshaler 的类型按值处理
+func isConfigSection(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// setConfigValue 在 setValue 的基础上支持时间间隔和逗号分隔的切片
+func setConfigValue(v reflect.Value, s string) error {
+	switch {
+	case v.Kind() == reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := setConfigValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+
+	case v.Type() == durationType:
+		d, err := parseDuration(s)
+		if err != nil {
+			return errors.New("must be a duration such as 30s or 1m30s")
+		}
+		v.SetInt(int64(d))
+		return nil
+
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		var parts []string
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				parts = append(parts, part)
+			}
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setConfigValue(slice.Index(i), part); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	return setValue(v, s, "")
+}
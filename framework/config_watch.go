@@ -0,0 +1,220 @@
+// 配置热加载
+// WatchConfig 定时检查配置文件 (包括 include 的文件) 是否变化, 变化之后重新加载, 整体替换配置,
+// 再通知用 OnChange 订阅了变化的键的函数, 不用重启就能修改日志级别, 功能开关, 站点标题之类的配置:
+//
+//	cfg, err := WatchConfig("conf/app.conf", 2*time.Second)
+//	cfg.OnChange("site::title", func(old, new string) { log.Printf("title: %s -> %s", old, new) })
+//	app.OnShutdown(func(ctx context.Context) error { cfg.StopWatch(); return nil })
+//
+// 先比较修改时间和大小, 变了再比较内容的哈希. 新的文件有错误时保留原来的配置, 文件再次变化时重试.
+package framework
+
+import (
+	"crypto/sha256"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type configWatch struct {
+	stop chan struct{}
+	once sync.Once
+
+	// 只在 watch 的 goroutine 中使用
+	stamps map[string]fileStamp
+	hash   [sha256.Size]byte
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// WatchConfig 加载配置文件 filename, 之后每隔 interval 检查一次文件是否变化, 用 StopWatch 停止
+func WatchConfig(filename string, interval time.Duration) (*Config, error) {
+	cfg, err := LoadConfig(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Watch(interval)
+	return cfg, nil
+}
+
+// Watch 每隔 interval 检查一次配置的文件是否变化, 用于 LoadLayeredConfig 得到的配置, 用 StopWatch 停止.
+// 已经在检查时不做任何事.
+func (c *Config) Watch(interval time.Duration) {
+	c.mu.Lock()
+	if c.watch != nil {
+		c.mu.Unlock()
+		return
+	}
+	w := &configWatch{stop: make(chan struct{})}
+	c.watch = w
+	c.mu.Unlock()
+
+	w.changed(c.watchFiles())
+	go c.watchLoop(w, interval)
+}
+
+// StopWatch 停止 WatchConfig 启动的检查, 可以多次调用
+func (c *Config) StopWatch() {
+	c.mu.RLock()
+	w := c.watch
+	c.mu.RUnlock()
+
+	if w != nil {
+		w.once.Do(func() { close(w.stop) })
+	}
+}
+
+// OnChange 订阅 key 的变化, 重新加载, Set 或 Delete 之后 key 的值变了就调用 fn.
+// key 的写法同 String, 按运行模式覆盖之后的值比较, 不存在的键的值为空字符串. fn 在持有锁之外调用.
+func (c *Config) OnChange(key string, fn func(old, new string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subscribers == nil {
+		c.subscribers = map[string][]func(old, new string){}
+	}
+	c.subscribers[key] = append(c.subscribers[key], fn)
+}
+
+// Reload 重新读取配置文件, 替换当前的配置, 然后通知订阅者. 出错时保留原来的配置.
+// 还没有 SaveConfigFile 的修改会被丢掉.
+func (c *Config) Reload() error {
+	c.mu.RLock()
+	filename, providers := c.filename, c.providers
+	c.mu.RUnlock()
+
+	var next *Config
+	var err error
+	if providers != nil {
+		next, err = LoadLayeredConfig(providers...)
+	} else {
+		next, err = LoadConfig(filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.snapshot()
+	c.runMode = next.runMode
+	c.sections = next.sections
+	c.comment = next.comment
+	c.data = next.data
+	c.offset = next.offset
+	c.pos = next.pos
+	c.files = next.files
+	c.edited = nil
+	c.secrets = secretCache{}
+	changes := c.changes(old)
+	c.mu.Unlock()
+
+	notify(changes)
+	return nil
+}
+
+// snapshot 返回所有订阅了的键的当前值, 调用者需要持有锁
+func (c *Config) snapshot() map[string]string {
+	if len(c.subscribers) == 0 {
+		return nil
+	}
+
+	values := make(map[string]string, len(c.subscribers))
+	for key := range c.subscribers {
+		values[key], _ = c.value(key)
+	}
+	return values
+}
+
+// changes 比较 snapshot 的结果和当前的值, 返回需要调用的函数, 调用者需要持有锁
+func (c *Config) changes(old map[string]string) []func() {
+	var calls []func()
+	for key, fns := range c.subscribers {
+		before := old[key]
+		after, _ := c.value(key)
+		if before == after {
+			continue
+		}
+		for _, fn := range fns {
+			fn := fn
+			calls = append(calls, func() { fn(before, after) })
+		}
+	}
+	return calls
+}
+
+func notify(calls []func()) {
+	for _, call := range calls {
+		call()
+	}
+}
+
+func (c *Config) watchFiles() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]string(nil), c.files...)
+}
+
+func (c *Config) watchLoop(w *configWatch, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if !w.changed(c.watchFiles()) {
+			continue
+		}
+		if err := c.Reload(); err != nil {
+			log.Printf("config: reload: %v", err)
+		}
+	}
+}
+
+// changed 检查 files 是否变化: 修改时间和大小都没变时认为没有变化, 否则比较所有文件内容的哈希
+func (w *configWatch) changed(files []string) bool {
+	stamps := make(map[string]fileStamp, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			stamps[file] = fileStamp{info.ModTime(), info.Size()}
+		}
+	}
+
+	same := len(stamps) == len(w.stamps)
+	for file, stamp := range stamps {
+		if prev, ok := w.stamps[file]; !ok || !prev.modTime.Equal(stamp.modTime) || prev.size != stamp.size {
+			same = false
+		}
+	}
+	w.stamps = stamps
+	if same {
+		return false
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		io.WriteString(hash, file+"\x00")
+		if f, err := os.Open(file); err == nil {
+			io.Copy(hash, f)
+			f.Close()
+		}
+		hash.Write([]byte{0})
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	if sum == w.hash {
+		return false
+	}
+	w.hash = sum
+	return true
+}
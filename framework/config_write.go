@@ -0,0 +1,341 @@
+// 配置写回
+// Set 和 Delete 修改内存中的配置, SaveConfigFile 把修改写回文件:
+// 原文件的注释, 空行, 键的顺序和引号都保留, 只改动被修改的行, 新的键加在所在段的最后, 新的段加在文件末尾.
+//
+//	cfg.Set("site::title", "My Blog")
+//	err := cfg.SaveConfigFile("conf/app.conf")
+//
+// include 进来的文件不会被修改, 其中的键被修改之后写到主文件中.
+package framework
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Set 设置 key 的值. key 已经存在时修改它实际所在的段 (运行模式段中有覆盖时修改覆盖的值),
+// 否则按 section::key 或者已有的段 section.key 加到对应的段中, 都不是时加到默认段.
+// 值中的 ${ENV} 在保存之后重新加载时才会替换. 值变化时通知 OnChange 的订阅者.
+func (c *Config) Set(key, value string) {
+	c.mu.Lock()
+	old := c.snapshot()
+
+	section, name, ok := c.locate(key)
+	if !ok {
+		section, name = c.newKey(key)
+	}
+
+	c.addSection(section)
+	c.data[section][name] = value
+	c.markEdited(section, name)
+
+	if section == DefaultSection && name == "runmode" {
+		c.runMode = value
+	}
+
+	changes := c.changes(old)
+	c.mu.Unlock()
+	notify(changes)
+}
+
+// Delete 删除 key, 返回 key 是否存在. 运行模式段中有覆盖时只删除覆盖的值.
+func (c *Config) Delete(key string) bool {
+	c.mu.Lock()
+	old := c.snapshot()
+
+	section, name, ok := c.locate(key)
+	if !ok {
+		c.mu.Unlock()
+		return false
+	}
+
+	delete(c.data[section], name)
+	delete(c.offset[section], name)
+	delete(c.pos[section], name)
+	c.markEdited(section, name)
+
+	if section == DefaultSection && name == "runmode" {
+		c.runMode = ""
+	}
+
+	changes := c.changes(old)
+	c.mu.Unlock()
+	notify(changes)
+	return true
+}
+
+// newKey 返回新的键所在的 段, 键
+func (c *Config) newKey(key string) (string, string) {
+	if section, name, ok := strings.Cut(key, "::"); ok {
+		return section, name
+	}
+	if i := strings.LastIndexByte(key, '.'); i > 0 {
+		if _, ok := c.data[key[:i]]; ok {
+			return key[:i], key[i+1:]
+		}
+	}
+	return DefaultSection, key
+}
+
+func (c *Config) markEdited(section, name string) {
+	if c.edited == nil {
+		c.edited = map[string]map[string]bool{}
+	}
+	if c.edited[section] == nil {
+		c.edited[section] = map[string]bool{}
+	}
+	c.edited[section][name] = true
+}
+
+// SaveConfigFile 把配置写到 filename. 内容以加载时的文件为基础, 只改动 Set 和 Delete 过的键,
+// 先写临时文件再 rename, 中途出错不会破坏原文件. 保存之后 filename 成为新的基础文件.
+func (c *Config) SaveConfigFile(filename string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var src []string
+	if c.filename != "" {
+		lines, err := readLines(c.filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		src = lines
+	}
+
+	out, err := c.rewrite(src)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for _, line := range out {
+		b.WriteString(line.text)
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := writeFileAtomic(filename, []byte(b.String()), perm); err != nil {
+		return err
+	}
+
+	c.filename = filename
+	c.edited = nil
+
+	// 行的位置变了, offset 和行号重新计算
+	for section := range c.offset {
+		c.offset[section] = map[string]int64{}
+	}
+	off, lineNo := int64(0), 1
+	for _, line := range out {
+		off += int64(len(line.text))
+		if _, ok := c.data[line.section][line.key]; ok && line.key != "" {
+			c.offset[line.section][line.key] = off
+			c.pos[line.section][line.key] = fmt.Sprintf("%s:%d", filename, lineNo)
+		}
+		lineNo += strings.Count(line.text, "\n")
+	}
+
+	return nil
+}
+
+// configLine 是写回时的一个条目, 可能有多行, key 不为空时是 section 中 key 的赋值
+type configLine struct {
+	text         string
+	kind         configEntryKind
+	section, key string
+}
+
+// rewrite 在原文件的行 src 上应用修改
+func (c *Config) rewrite(src []string) ([]configLine, error) {
+	entries, err := lexConfig(c.filename, strings.Join(src, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]configLine, 0, len(entries))
+	written := map[string]map[string]bool{}
+
+	// end 是段中新的键插入的位置: 最后一个键或者段头的下一个条目
+	end := map[string]int{}
+	firstHeader := -1
+
+	section := DefaultSection
+	for _, e := range entries {
+		text := strings.Join(src[e.line-1:e.endLine], "")
+		switch e.kind {
+		case configSection:
+			section = e.name
+			if firstHeader < 0 {
+				firstHeader = len(out)
+			}
+			out = append(out, configLine{text: text, kind: e.kind, section: section})
+			end[section] = len(out)
+			continue
+
+		case configKey:
+			if written[section] == nil {
+				written[section] = map[string]bool{}
+			}
+			if c.edited[section][e.name] {
+				value, ok := c.data[section][e.name]
+				if !ok || written[section][e.name] {
+					// 删除的键, 或者重复的键只保留第一个
+					continue
+				}
+				text = rewriteValue(src[e.line-1], src[e.endLine-1], e, value)
+			}
+			written[section][e.name] = true
+			out = append(out, configLine{text: text, kind: e.kind, section: section, key: e.name})
+			end[section] = len(out)
+			continue
+		}
+		out = append(out, configLine{text: text, kind: e.kind})
+	}
+
+	if n := len(out); n > 0 && !strings.HasSuffix(out[n-1].text, "\n") {
+		out[n-1].text += "\n"
+	}
+	if _, ok := end[DefaultSection]; !ok {
+		end[DefaultSection] = len(out)
+		if firstHeader >= 0 {
+			// 插到第一个段头之前, 紧挨着段头的注释和它上面的空行属于这个段
+			pos := firstHeader
+			for pos > 0 && out[pos-1].kind == configComment {
+				pos--
+			}
+			for pos > 0 && out[pos-1].kind == configBlank {
+				pos--
+			}
+			end[DefaultSection] = pos
+		}
+	}
+
+	// 新的键, 按段和键名排序, 每段插入到 end 的位置
+	inserts := map[int][]configLine{}
+	var appended []configLine
+	for _, section := range c.sections {
+		var names []string
+		for name := range c.edited[section] {
+			if _, ok := c.data[section][name]; ok && !written[section][name] {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+
+		var lines []configLine
+		for _, name := range names {
+			lines = append(lines, configLine{text: name + " = " + formatValue(c.data[section][name], false, "") + "\n", section: section, key: name})
+		}
+
+		pos, ok := end[section]
+		if !ok {
+			appended = append(appended, configLine{text: "\n"}, configLine{text: "[" + section + "]\n", section: section})
+			appended = append(appended, lines...)
+			continue
+		}
+		inserts[pos] = append(inserts[pos], lines...)
+	}
+
+	result := make([]configLine, 0, len(out)+len(appended))
+	for i := 0; i <= len(out); i++ {
+		result = append(result, inserts[i]...)
+		if i < len(out) {
+			result = append(result, out[i])
+		}
+	}
+	if len(result) == 0 && len(appended) > 0 {
+		// 新文件不以空行开头
+		appended = appended[1:]
+	}
+	return append(result, appended...), nil
+}
+
+// rewriteValue 替换条目 e 的值, 保留键, 等号两边的空白, 引号, 注释和换行符.
+// first 和 last 是条目的第一行和最后一行.
+func rewriteValue(first, last string, e configEntry, value string) string {
+	i := strings.IndexByte(first, '=')
+	rest := first[i+1:]
+	prefix := first[:i+1] + rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+
+	newline := ""
+	if strings.HasSuffix(last, "\r\n") {
+		newline = "\r\n"
+	} else if strings.HasSuffix(last, "\n") {
+		newline = "\n"
+	}
+
+	v := formatValue(value, e.quoted, e.heredoc)
+	if e.comment != "" {
+		// 多行的值, 注释在 <<EOF 之后
+		if i := strings.IndexByte(v, '\n'); i >= 0 {
+			v = v[:i] + " " + e.comment + v[i:]
+		} else {
+			v += " " + e.comment
+		}
+	}
+	if newline == "\r\n" {
+		v = strings.ReplaceAll(v, "\n", "\r\n")
+	}
+
+	return prefix + v + newline
+}
+
+// readLines 读取文件的所有行, 每行保留换行符
+func readLines(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	buf := bufio.NewReader(file)
+	for {
+		line, err := buf.ReadString('\n')
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeFileAtomic 先写到同一目录下的临时文件, 写完之后再改名, 不会留下写了一半的文件
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
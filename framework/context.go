@@ -1,9 +1,172 @@
 package framework
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
 
 type Context struct {
 	ResponseWriter http.ResponseWriter
 	Request *http.Request
 	Params map[string]string
+
+	router *RegistorController
+	rootWriter *statusWriter // ServeHTTP 最外层的 ResponseWriter, 中间件怎么包装都能知道是否已经开始响应
+
+	err error // Abort 设置的错误, 处理者返回之后交给路由渲染
+
+	bodyLimited bool // 已经用 MaxBytesReader 限制了请求体, 见 limitBody
+
+	mu    sync.RWMutex
+	store map[string]interface{} // Set, Get 的键值
+
+	query    url.Values // 解析过的 query, rawQuery 变了才重新解析
+	rawQuery string
+}
+
+// views 返回路由的模板引擎, Context 不是路由创建的时候返回 nil
+func (ctx *Context) views() *ViewEngine {
+	if ctx.router == nil {
+		return nil
+	}
+	return ctx.router.Views
+}
+
+// contextKey 是在 request 的 context 中存储 Context 的 key 的类型
+type contextKey int
+
+// frameworkContextKey 路由匹配之后把 Context 存到 request 的 context 中
+const frameworkContextKey contextKey = 0
+
+// RouteParams 返回请求匹配的路由参数, 请求没有经过路由时返回 nil.
+// 不使用 Context 的 http.Handler 和中间件可以用它读取路由参数.
+func RouteParams(r *http.Request) map[string]string {
+	if ctx := FromRequest(r); ctx != nil {
+		return ctx.Params
+	}
+	return nil
+}
+
+// FromRequest 返回路由为请求创建的 Context, 中间件可以通过它拿到路由参数.
+// 请求没有经过路由时返回 nil.
+func FromRequest(r *http.Request) *Context {
+	ctx, _ := r.Context().Value(frameworkContextKey).(*Context)
+	return ctx
+}
+
+// Param 返回路由参数, 没有时返回空字符串
+func (ctx *Context) Param(name string) string {
+	return ctx.Params[name]
+}
+
+// ParamInt 返回整数类型的路由参数, 参数不存在或者不是整数时返回 400 错误, 处理函数可以直接返回它
+func (ctx *Context) ParamInt(name string) (int, error) {
+	value, ok := ctx.Params[name]
+	if !ok {
+		return 0, NewHTTPError(http.StatusBadRequest, "missing param "+name)
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &HTTPError{Code: http.StatusBadRequest, Message: "invalid param " + name, Err: err}
+	}
+	return n, nil
+}
+
+// Query 返回 query 参数 key 的第一个值
+func (ctx *Context) Query(key string) string {
+	return ctx.queryValues().Get(key)
+}
+
+// DefaultQuery 同 Query, query 中没有 key 时返回 def
+func (ctx *Context) DefaultQuery(key, def string) string {
+	if values, ok := ctx.queryValues()[key]; ok && len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
+
+func (ctx *Context) queryValues() url.Values {
+	if ctx.query == nil || ctx.rawQuery != ctx.Request.URL.RawQuery {
+		ctx.query = ctx.Request.URL.Query()
+		ctx.rawQuery = ctx.Request.URL.RawQuery
+	}
+	return ctx.query
+}
+
+// FormValue 返回表单字段 key 的第一个值, 请求体中的值优先于 query
+func (ctx *Context) FormValue(key string) string {
+	return ctx.Request.FormValue(key)
+}
+
+// Cookie 返回请求中名为 name 的 cookie 的值, 没有时返回空字符串
+func (ctx *Context) Cookie(name string) string {
+	c, err := ctx.Request.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// SetCookie 在响应中设置 cookie
+func (ctx *Context) SetCookie(c *http.Cookie) {
+	http.SetCookie(ctx.ResponseWriter, c)
+}
+
+// Header 返回请求头 key
+func (ctx *Context) Header(key string) string {
+	return ctx.Request.Header.Get(key)
+}
+
+// SetHeader 设置响应头 key, value 为空时删除
+func (ctx *Context) SetHeader(key, value string) {
+	if value == "" {
+		ctx.ResponseWriter.Header().Del(key)
+		return
+	}
+	ctx.ResponseWriter.Header().Set(key, value)
+}
+
+// Redirect 重定向到 url, code 是 3xx 状态码
+func (ctx *Context) Redirect(url string, code int) {
+	http.Redirect(ctx.ResponseWriter, ctx.Request, url, code)
+}
+
+// Status 写出响应的状态码, 之后不能再修改响应头
+func (ctx *Context) Status(code int) {
+	ctx.ResponseWriter.WriteHeader(code)
+}
+
+// Abort 结束请求, 处理者返回之后路由按状态码渲染错误页面. 调用之后应当直接 return.
+// 在控制器中调用同 Controller.Abort.
+func (ctx *Context) Abort(code int) {
+	ctx.err = NewHTTPError(code, "")
+}
+
+// Set 保存只在这个请求中有效的键值, 中间件可以用它给处理者传递数据
+func (ctx *Context) Set(key string, value interface{}) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.store == nil {
+		ctx.store = make(map[string]interface{})
+	}
+	ctx.store[key] = value
+}
+
+// Get 返回 Set 保存的值
+func (ctx *Context) Get(key string) (interface{}, bool) {
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+
+	value, ok := ctx.store[key]
+	return value, ok
+}
+
+// Context 返回请求的 context.Context, 客户端断开或者超时之后会被取消
+func (ctx *Context) Context() context.Context {
+	return ctx.Request.Context()
 }
@@ -0,0 +1,144 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContextAccessors(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			FromRequest(r).Set("user", "hyl")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	rc.Post("/users/:id", func(ctx *Context) error {
+		id, err := ctx.ParamInt("id")
+		if err != nil {
+			return err
+		}
+		if _, err := ctx.ParamInt("missing"); StatusCode(err) != http.StatusBadRequest {
+			t.Fatalf("bad missing param: got %v", err)
+		}
+
+		user, _ := ctx.Get("user")
+		if _, ok := ctx.Get("nope"); ok {
+			t.Fatalf("bad get: want missing key")
+		}
+
+		values := []string{
+			ctx.Param("id"),
+			ctx.Query("page"),
+			ctx.DefaultQuery("size", "10"),
+			ctx.DefaultQuery("empty", "x"),
+			ctx.FormValue("title"),
+			ctx.Cookie("sid"),
+			ctx.Cookie("nope"),
+			ctx.Header("X-Test"),
+			user.(string),
+		}
+		want := []string{"42", "2", "10", "", "hello", "abc", "", "yes", "hyl"}
+		for i := range want {
+			if values[i] != want[i] {
+				t.Fatalf("%v: bad value: got %q, want %q", i+1, values[i], want[i])
+			}
+		}
+		if id != 42 {
+			t.Fatalf("bad id: got %d, want %d", id, 42)
+		}
+		if ctx.Context() != ctx.Request.Context() {
+			t.Fatalf("bad context")
+		}
+
+		ctx.SetCookie(&http.Cookie{Name: "seen", Value: "1"})
+		ctx.SetHeader("X-Id", ctx.Param("id"))
+		ctx.Status(http.StatusAccepted)
+		return nil
+	})
+
+	r := httptest.NewRequest("POST", "/users/42?page=2&empty=", strings.NewReader("title=hello"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Test", "yes")
+	r.AddCookie(&http.Cookie{Name: "sid", Value: "abc"})
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("bad code: got %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if got := w.Header().Get("X-Id"); got != "42" {
+		t.Fatalf("bad header: got %q, want %q", got, "42")
+	}
+	if got := w.Header().Get("Set-Cookie"); got != "seen=1" {
+		t.Fatalf("bad cookie: got %q, want %q", got, "seen=1")
+	}
+	if got := r.URL.RawQuery; got != "page=2&empty=" {
+		t.Fatalf("bad raw query: got %q, want %q", got, "page=2&empty=")
+	}
+
+	w = serve(rc, "POST", "/users/abc")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("bad code: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+type ctxAbortController struct {
+	Controller
+}
+
+func (c *ctxAbortController) Get() {
+	c.Ctx.Abort(http.StatusForbidden)
+}
+
+func TestContextAbortRedirect(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Get("/abort", func(ctx *Context) {
+		ctx.Abort(http.StatusNotFound)
+	})
+	rc.Get("/redirect", func(ctx *Context) {
+		ctx.Redirect("/login", http.StatusFound)
+	})
+	rc.Add("/controller", &ctxAbortController{})
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/abort", http.StatusNotFound, ""},
+		{"/redirect", http.StatusFound, "/login"},
+		{"/controller", http.StatusForbidden, ""},
+	}
+
+	for i, tt := range tests {
+		w := serve(rc, "GET", tt.path)
+		if w.Code != tt.code {
+			t.Fatalf("%v: bad code: got %d, want %d", i+1, w.Code, tt.code)
+		}
+		if got := w.Header().Get("Location"); got != tt.location {
+			t.Fatalf("%v: bad location: got %q, want %q", i+1, got, tt.location)
+		}
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Get("/", func(ctx *Context) error {
+		<-ctx.Context().Done()
+		return ctx.Context().Err()
+	})
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, httptest.NewRequest("GET", "/", nil).WithContext(reqCtx))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("bad code: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
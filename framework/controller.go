@@ -2,18 +2,15 @@ package framework
 
 import (
 	"html/template"
+	"net/http"
+	"reflect"
 )
 
+// ControllerInterface 是控制器的生命周期方法. 处理请求的 Get, Post, Delete, Put, Head, Patch, Options
+// 由子类按需声明, 也可以从嵌入的控制器中继承, 没有的请求方法路由直接返回 405.
 type ControllerInterface interface {
 	Init(ct *Context, cn string)    //初始化上下文和子类名称
 	Prepare()                       //开始执行之前的一些处理
-	Get()                           //method=GET的处理
-	Post()                          //method=POST的处理
-	Delete()                        //method=DELETE的处理
-	Put()                           //method=PUT的处理
-	Head()                          //method=HEAD的处理
-	Patch()                         //method=PATCH的处理
-	Options()                       //method=OPTIONS的处理
 	Finish()                        //执行完成之后的处理
 	Render() error                  //执行完method对应的方法之后渲染页面
 }
@@ -26,57 +23,157 @@ type Controller struct {
 	TplNames  string
 	Layout    []string
 	TplExt    string
+
+	// MethodName 是处理当前请求的方法名, 和 ChildName 一起决定默认模板 ChildName/MethodName.TplExt
+	MethodName string
+	// LayoutSections 布局中的区块, 区块名: 模板名, 见 ViewEngine.RenderLayout
+	LayoutSections map[string]string
+
+	// EnableRender 为 false 时方法执行完之后不再自动渲染模板, 默认 true
+	EnableRender bool
+	// PrettyPrint 为 true 时 ServeJSON, ServeXML 输出缩进后的结果
+	PrettyPrint bool
+
+	stopped  bool  // 调用了 Abort, Redirect 或 StopRun, 不再执行后续方法
+	abortErr error // Abort 时交给路由渲染的错误
+	status   int   // Negotiate 选中 HTML 时的状态码, 由 Render 发出
 }
 
 func (c *Controller) Init(ctx *Context, cn string) {
-	c.Data = make(map[interface{}]interface{})
+	if c.Data == nil {
+		c.Data = make(map[interface{}]interface{})
+	}
+	if c.LayoutSections == nil {
+		c.LayoutSections = make(map[string]string)
+	}
 	c.Layout = make([]string, 0)
 	c.TplNames = ""
 	c.ChildName = cn
 	c.Ctx = ctx
 	c.TplExt = "html"
+	c.EnableRender = true
 }
 
 func (c *Controller) Prepare() {
 
 }
 
-func (c *Controller) Get() {
-	c.Tpl.Execute(c.Ctx.ResponseWriter, c.Data)
+func (c *Controller) Finish() {
+
 }
 
-func (*Controller) Post() {
-	panic("implement me")
+// Render 渲染模板. 设置了 Tpl 时直接执行 Tpl, 否则用路由的 ViewEngine 渲染 TplNames 并套上 Layout,
+// TplNames 为空时使用 ChildName/MethodName.TplExt, 这个模板不存在就什么都不渲染.
+func (c *Controller) Render() error {
+	if c.status == 0 {
+		return c.render(c.Ctx.ResponseWriter)
+	}
+
+	// Negotiate 设置的状态码在写第一个字节时才发出, 模板出错时还能改成错误页面
+	w := &headerWriter{ResponseWriter: c.Ctx.ResponseWriter, code: c.status}
+	if err := c.render(w); err != nil {
+		return err
+	}
+	if !w.wroteHeader {
+		w.ResponseWriter.WriteHeader(c.status)
+	}
+	return nil
 }
 
-func (*Controller) Delete() {
-	panic("implement me")
+func (c *Controller) render(w http.ResponseWriter) error {
+	if !c.EnableRender {
+		return nil
+	}
+
+	if c.Tpl != nil {
+		return c.Tpl.Execute(w, c.Data)
+	}
+
+	views := c.Ctx.views()
+	if views == nil {
+		return nil
+	}
+
+	name := c.TplNames
+	if name == "" {
+		name = templateName(c.ChildName, c.MethodName, c.TplExt)
+		if !views.Exists(name) {
+			return nil
+		}
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	return views.RenderLayout(w, name, c.Layout, c.LayoutSections, c.Data)
 }
 
-func (*Controller) Put() {
-	panic("implement me")
+// Abort 结束请求, 路由按状态码渲染错误页面. 在 Prepare 中调用可以跳过处理方法和 Render,
+// 调用之后应当直接 return.
+func (c *Controller) Abort(code int) {
+	c.abortErr = NewHTTPError(code, "")
+	c.stopped = true
 }
 
-func (*Controller) Head() {
-	panic("implement me")
+// Redirect 重定向并结束请求, 同 Abort 一样会跳过后续方法
+func (c *Controller) Redirect(url string, code int) {
+	http.Redirect(c.Ctx.ResponseWriter, c.Ctx.Request, url, code)
+	c.stopped = true
 }
 
-func (*Controller) Patch() {
-	panic("implement me")
+// StopRun 结束请求, 不再执行后续方法, 响应由控制器自己写好
+func (c *Controller) StopRun() {
+	c.stopped = true
 }
 
-func (*Controller) Options() {
-	panic("implement me")
+func (c *Controller) stopState() (bool, error) {
+	if c.abortErr == nil && c.Ctx != nil && c.Ctx.err != nil {
+		// 控制器中调用了 c.Ctx.Abort
+		return true, c.Ctx.err
+	}
+	return c.stopped, c.abortErr
 }
 
-func (*Controller) Finish() {
-	panic("implement me")
+// reset 清空控制器, 复用的控制器放回池子之前调用, Data 和 LayoutSections 的 map 留着下次用
+func (c *Controller) reset() {
+	data, sections := c.Data, c.LayoutSections
+	for k := range data {
+		delete(data, k)
+	}
+	for k := range sections {
+		delete(sections, k)
+	}
+	*c = Controller{Data: data, LayoutSections: sections}
 }
 
-func (c *Controller) Render() error {
-	c.Tpl.Execute(c.Ctx.ResponseWriter, c.Data)
+func (c *Controller) setMethodName(name string) {
+	c.MethodName = name
+}
 
-	return nil
+// methodNameSetter 由 Controller 实现, 路由在 Init 之后告诉控制器处理请求的方法名
+type methodNameSetter interface {
+	setMethodName(name string)
+}
+
+// resetter 由 Controller 实现, 见 Route.Pool
+type resetter interface {
+	reset()
 }
 
+// stopper 由 Controller 实现, 路由在 Prepare 和处理方法之后检查控制器是否要结束请求
+type stopper interface {
+	stopState() (bool, error)
+}
 
+func isStopped(c ControllerInterface) (bool, error) {
+	if s, ok := c.(stopper); ok {
+		return s.stopState()
+	}
+	return false, nil
+}
+
+// hasHandler 判断控制器 t 是否有处理请求的方法 name, 包括从嵌入的控制器中提升的方法
+func hasHandler(t reflect.Type, name string) bool {
+	m, ok := reflect.PtrTo(t).MethodByName(name)
+	return ok && m.Type.NumIn() == 1 && m.Type.NumOut() == 0
+}
@@ -0,0 +1,207 @@
+package framework
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lifecycleController 记录生命周期中每一步的调用
+type lifecycleController struct {
+	Controller
+}
+
+var lifecycleCalls []string
+
+func (c *lifecycleController) Prepare() {
+	lifecycleCalls = append(lifecycleCalls, "prepare")
+	switch c.Ctx.Request.URL.Query().Get("do") {
+	case "abort":
+		c.Abort(http.StatusUnauthorized)
+	case "redirect":
+		c.Redirect("/login", http.StatusFound)
+	}
+}
+
+func (c *lifecycleController) Get() {
+	lifecycleCalls = append(lifecycleCalls, "get")
+	switch c.Ctx.Request.URL.Query().Get("do") {
+	case "panic":
+		panic("boom")
+	case "raw":
+		c.EnableRender = false
+		c.Ctx.ResponseWriter.Write([]byte("raw"))
+		return
+	case "badtpl":
+		c.Tpl = template.Must(template.New("bad").Parse(`{{template "missing" .}}`))
+		return
+	}
+
+	c.Tpl = template.Must(template.New("ok").Parse(`hello {{index . "name"}}`))
+	c.Data["name"] = "hyl"
+}
+
+func (c *lifecycleController) Render() error {
+	lifecycleCalls = append(lifecycleCalls, "render")
+	return c.Controller.Render()
+}
+
+func (c *lifecycleController) Finish() {
+	lifecycleCalls = append(lifecycleCalls, "finish")
+}
+
+func TestControllerLifecycle(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Add("/", &lifecycleController{})
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+		calls  string
+	}{
+		{"/", 200, "hello hyl", "prepare,get,render,finish"},
+		{"/?do=abort", 401, "Unauthorized\n", "prepare,finish"},
+		{"/?do=redirect", 302, "<a href=\"/login\">Found</a>.\n\n", "prepare,finish"},
+		{"/?do=panic", 500, "Internal Server Error\n", "prepare,get,finish"},
+		{"/?do=raw", 200, "raw", "prepare,get,render,finish"},
+		{"/?do=badtpl", 500, "Internal Server Error\n", "prepare,get,render,finish"},
+	}
+	for i, v := range tests {
+		lifecycleCalls = nil
+		w := serve(rc, "GET", v.target)
+		if w.Code != v.code {
+			t.Fatalf("%v: bad status: got %v, want %v", i+1, w.Code, v.code)
+		}
+		if w.Body.String() != v.body {
+			t.Fatalf("%v: bad body: got %q, want %q", i+1, w.Body.String(), v.body)
+		}
+		if calls := strings.Join(lifecycleCalls, ","); calls != v.calls {
+			t.Fatalf("%v: bad lifecycle: got %q, want %q", i+1, calls, v.calls)
+		}
+	}
+}
+
+type counterController struct {
+	Controller
+	hits *int
+}
+
+func (c *counterController) Show() {
+	*c.hits++
+	c.Ctx.ResponseWriter.Write([]byte("show"))
+	c.Data["dirty"] = true
+}
+
+func TestControllerFactoryAndPool(t *testing.T) {
+	hits := 0
+	rc := &RegistorController{}
+	rc.AddFactory("/count", func() ControllerInterface {
+		return &counterController{hits: &hits}
+	}, "get:Show").Pool()
+
+	for i := 0; i < 3; i++ {
+		if w := serve(rc, "GET", "/count"); w.Body.String() != "show" {
+			t.Fatalf("bad body: %q", w.Body.String())
+		}
+	}
+	if hits != 3 {
+		t.Fatalf("bad hits: got %v, want 3", hits)
+	}
+
+	route, _ := rc.tree.lookup("/count", nil)
+	c := route.handlers["GET"].acquire().(*counterController)
+	if len(c.Data) != 0 || c.Ctx != nil || c.hits != &hits {
+		t.Fatalf("pooled controller not reset: %+v", c)
+	}
+}
+
+type benchController struct {
+	Controller
+}
+
+func (c *benchController) Get() {}
+
+func (c *benchController) List() {}
+
+// BenchmarkControllerReflect 是原来每个请求反射创建控制器, 用 MethodByName 查找方法的实现
+func BenchmarkControllerReflect(b *testing.B) {
+	t := reflect.TypeOf(benchController{})
+	ctx := &Context{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		vc := reflect.New(t)
+		vc.MethodByName("Init").Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(t.Name())})
+		vc.MethodByName("Prepare").Call(nil)
+		vc.MethodByName("Get").Call(nil)
+		vc.MethodByName("Render").Call(nil)
+		vc.MethodByName("Finish").Call(nil)
+	}
+}
+
+func benchmarkController(b *testing.B, name string, pool bool) {
+	rc := &RegistorController{}
+	route := rc.Add("/", &benchController{}, "get:"+name)
+	if pool {
+		route.Pool()
+	}
+	h := route.handlers["GET"]
+	ctx := &Context{}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := runController(h, ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkControllerCompiled(b *testing.B) {
+	benchmarkController(b, "Get", false)
+}
+
+func BenchmarkControllerCompiledCustomMethod(b *testing.B) {
+	benchmarkController(b, "List", false)
+}
+
+func BenchmarkControllerPooled(b *testing.B) {
+	benchmarkController(b, "Get", true)
+}
+
+// discardWriter 丢弃响应, 不像 httptest.ResponseRecorder 那样自己分配内存
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// benchmarkServeHTTP 经过路由匹配, 中间件和控制器的完整请求处理
+func benchmarkServeHTTP(b *testing.B, pool bool) {
+	rc := &RegistorController{}
+	rc.Use(func(next http.Handler) http.Handler { return next })
+	route := rc.Add("/posts/:id", &benchController{}, "get:Get")
+	if pool {
+		route.Pool()
+	}
+	r := httptest.NewRequest("GET", "/posts/1", nil)
+	w := &discardWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rc.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkServeHTTPController(b *testing.B) {
+	benchmarkServeHTTP(b, false)
+}
+
+func BenchmarkServeHTTPControllerPooled(b *testing.B) {
+	benchmarkServeHTTP(b, true)
+}
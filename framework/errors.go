@@ -0,0 +1,266 @@
+// 错误处理
+// ServeHTTP 会捕获 panic, 和处理函数返回的错误一起按状态码渲染错误页面.
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// HTTPError 是带状态码的错误, panic 或者返回它时按 Code 响应
+type HTTPError struct {
+	Code    int
+	Message string // 展示给用户的信息, 为空时使用状态码对应的文本
+	Err     error  // 内部错误, 只在开发模式下展示
+}
+
+func NewHTTPError(code int, message string) *HTTPError {
+	return &HTTPError{Code: code, Message: message}
+}
+
+func (e *HTTPError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Code)
+	}
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// panicError 是从 panic 中恢复的错误, 保存 panic 时的堆栈
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+func (e *panicError) Unwrap() error {
+	err, _ := e.value.(error)
+	return err
+}
+
+// StatusCode 返回错误对应的状态码, 不认识的错误都是 500
+func StatusCode(err error) int {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.Code
+	}
+
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
+// ErrorData 是渲染错误页面时传给模板的数据
+type ErrorData struct {
+	Code    int
+	Status  string
+	Message string
+	DevMode bool
+
+	// 以下字段只在开发模式下有值
+	Err     error
+	Stack   string
+	Request *http.Request
+	Params  map[string]string
+}
+
+// ErrorPage 设置状态码 code 的错误页面模板, 模板数据是 *ErrorData
+func (rc *RegistorController) ErrorPage(code int, t *template.Template) {
+	if rc.errorPages == nil {
+		rc.errorPages = make(map[int]*template.Template)
+	}
+	rc.errorPages[code] = t
+}
+
+// LoadErrorPages 加载 dir 下以状态码命名的错误页面, 例如 404.html, 500.html
+func (rc *RegistorController) LoadErrorPages(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		code, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file), ".html"))
+		if err != nil {
+			continue
+		}
+
+		t, err := template.ParseFiles(file)
+		if err != nil {
+			return err
+		}
+		rc.ErrorPage(code, t)
+	}
+
+	return nil
+}
+
+// HandleError 按错误对应的状态码渲染错误页面, 5xx 错误会写日志.
+// 设置了 ErrorHandler 时交给它处理.
+func (rc *RegistorController) HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	if rc.ErrorHandler != nil {
+		rc.ErrorHandler(w, r, err)
+		return
+	}
+
+	code := StatusCode(err)
+
+	var pe *panicError
+	isPanic := errors.As(err, &pe)
+	if code >= http.StatusInternalServerError {
+		if isPanic {
+			log.Printf("%s %s: %v\n%s", r.Method, r.URL.RequestURI(), pe.value, pe.stack)
+		} else {
+			log.Printf("%s %s: %v", r.Method, r.URL.RequestURI(), err)
+		}
+	}
+
+	if responseStarted(w, r) {
+		// 已经开始响应了, 没法再改状态码
+		return
+	}
+
+	data := &ErrorData{
+		Code:    code,
+		Status:  http.StatusText(code),
+		Message: http.StatusText(code),
+		DevMode: rc.DevMode,
+	}
+
+	var he *HTTPError
+	if errors.As(err, &he) && he.Message != "" {
+		data.Message = he.Message
+	}
+
+	if rc.DevMode {
+		data.Err = err
+		data.Request = r
+		if isPanic {
+			data.Stack = string(pe.stack)
+		}
+		if ctx := FromRequest(r); ctx != nil {
+			data.Params = ctx.Params
+		}
+	}
+
+	t := rc.errorPages[code]
+	if t == nil && rc.DevMode {
+		t = devErrorPage
+	}
+
+	if t == nil {
+		http.Error(w, data.Message, code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	if err := t.Execute(w, data); err != nil {
+		log.Printf("render error page %d: %v", code, err)
+	}
+}
+
+// responseStarted 判断是否已经开始响应. 中间件 (例如 Gzip) 可能把 ResponseWriter 包了几层,
+// 沿着 Unwrap 往里找 statusWriter, 没有实现 Unwrap 的包装就看 ServeHTTP 最外层的 statusWriter.
+func responseStarted(w http.ResponseWriter, r *http.Request) bool {
+	for {
+		if sw, ok := w.(*statusWriter); ok && sw.status != 0 {
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+
+	ctx := FromRequest(r)
+	return ctx != nil && ctx.rootWriter != nil && ctx.rootWriter.status != 0
+}
+
+// notFound 处理没有匹配到路由的请求
+func (rc *RegistorController) notFound(w http.ResponseWriter, r *http.Request) {
+	if rc.NotFound != nil {
+		rc.NotFound.ServeHTTP(w, r)
+		return
+	}
+
+	rc.HandleError(w, r, NewHTTPError(http.StatusNotFound, ""))
+}
+
+// recoverPanic 把 panic 转成错误交给 HandleError
+func (rc *RegistorController) recoverPanic(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+
+	rc.HandleError(w, r, &panicError{value: v, stack: debug.Stack()})
+}
+
+// devErrorPage 开发模式下默认的错误页面, 展示错误, 堆栈, 请求和路由参数
+var devErrorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <title>{{.Code}} {{.Status}}</title>
+    <style>
+        body { font-family: sans-serif; margin: 2em; }
+        pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+        td { padding: 0 1em 0 0; vertical-align: top; }
+    </style>
+</head>
+<body>
+    <h1>{{.Code}} {{.Status}}</h1>
+    <p>{{.Message}}</p>
+    {{if .Err}}<h2>Error</h2>
+    <pre>{{.Err}}</pre>{{end}}
+    {{if .Stack}}<h2>Stack</h2>
+    <pre>{{.Stack}}</pre>{{end}}
+    {{with .Request}}<h2>Request</h2>
+    <table>
+        <tr><td>Method</td><td>{{.Method}}</td></tr>
+        <tr><td>URL</td><td>{{.URL}}</td></tr>
+        <tr><td>RemoteAddr</td><td>{{.RemoteAddr}}</td></tr>
+        {{range $key, $values := .Header}}<tr><td>{{$key}}</td><td>{{range $values}}{{.}} {{end}}</td></tr>
+        {{end}}
+    </table>{{end}}
+    {{if .Params}}<h2>Route params</h2>
+    <table>
+        {{range $key, $value := .Params}}<tr><td>{{$key}}</td><td>{{$value}}</td></tr>
+        {{end}}
+    </table>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,141 @@
+package framework
+
+import (
+	"compress/gzip"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 错误处理会写日志, 测试时不输出
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestErrorHandling(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Get("/panic", func(ctx *Context) {
+		panic("boom")
+	})
+	rc.Get("/forbidden", func(ctx *Context) {
+		panic(NewHTTPError(http.StatusForbidden, "no entry"))
+	})
+	rc.Get("/missing", func(ctx *Context) error {
+		return fs.ErrNotExist
+	})
+	rc.Get("/teapot", func(ctx *Context) error {
+		return &HTTPError{Code: http.StatusTeapot, Err: errors.New("secret")}
+	})
+	rc.Get("/written", func(ctx *Context) {
+		ctx.ResponseWriter.Write([]byte("partial"))
+		panic("late")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/panic", 500, "Internal Server Error\n"},
+		{"GET", "/forbidden", 403, "no entry\n"},
+		{"GET", "/missing", 404, "Not Found\n"},
+		{"GET", "/teapot", 418, "I'm a teapot\n"},
+		{"GET", "/written", 200, "partial"},
+		{"GET", "/nothing", 404, "Not Found\n"},
+		{"POST", "/panic", 405, "Method Not Allowed\n"},
+	}
+	for i, v := range tests {
+		w := serve(rc, v.method, v.path)
+		if w.Code != v.code {
+			t.Fatalf("%v: bad status: got %v, want %v", i+1, w.Code, v.code)
+		}
+		if w.Body.String() != v.body {
+			t.Fatalf("%v: bad body: got %q, want %q", i+1, w.Body.String(), v.body)
+		}
+	}
+}
+
+// opaqueWriter 包装 ResponseWriter, 没有实现 Unwrap
+type opaqueWriter struct {
+	http.ResponseWriter
+}
+
+func TestErrorAfterWrite(t *testing.T) {
+	rc := &RegistorController{}
+	partial := func(ctx *Context) error {
+		ctx.ResponseWriter.Write([]byte("partial"))
+		return errors.New("late")
+	}
+	rc.Group("/gzip", func(g *Group) {
+		g.Use(Gzip)
+		g.Get("/", partial)
+	})
+	rc.Group("/opaque", func(g *Group) {
+		g.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(opaqueWriter{w}, r)
+			})
+		})
+		g.Get("/", partial)
+	})
+
+	for i, path := range []string{"/gzip", "/opaque"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, r)
+
+		body := w.Body.String()
+		if w.Header().Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%v: gzip: %v", i+1, err)
+			}
+			b, _ := io.ReadAll(zr)
+			body = string(b)
+		}
+		if w.Code != 200 || body != "partial" {
+			t.Fatalf("%v: bad response for %s: got %d %q, want 200 %q", i+1, path, w.Code, body, "partial")
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	rc := &RegistorController{}
+	rc.ErrorPage(http.StatusNotFound, template.Must(template.New("404").Parse(`<h1>{{.Code}} {{.Message}}</h1>`)))
+	rc.Get("/users/:id", func(ctx *Context) {
+		panic("boom")
+	})
+
+	if w := serve(rc, "GET", "/nothing"); w.Code != 404 || w.Body.String() != "<h1>404 Not Found</h1>" {
+		t.Fatalf("bad 404 page: %v %q", w.Code, w.Body.String())
+	}
+
+	rc.DevMode = true
+	w := serve(rc, "GET", "/users/42")
+	if w.Code != 500 {
+		t.Fatalf("bad status: got %v", w.Code)
+	}
+	for _, want := range []string{"panic: boom", "errors_test.go", "<td>id</td><td>42</td>", "/users/42"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("dev error page should contain %q:\n%s", want, w.Body.String())
+		}
+	}
+
+	rc.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("custom"))
+	})
+	if w := serve(rc, "GET", "/nothing"); w.Body.String() != "custom" {
+		t.Fatalf("custom NotFound handler not used: %q", w.Body.String())
+	}
+}
@@ -0,0 +1,186 @@
+// 路由分组
+// 分组内注册的路由共享路径前缀和中间件, 分组可以嵌套, 也可以把另一个 RegistorController 挂载进来.
+package framework
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type Group struct {
+	rc          *RegistorController
+	parent      *Group
+	prefix      string
+	middlewares []Middleware
+}
+
+// Group 创建前缀为 prefix 的分组, 在 fn 中注册分组内的路由
+func (rc *RegistorController) Group(prefix string, fn func(g *Group)) *Group {
+	g := &Group{rc: rc, prefix: joinPath("", prefix)}
+	if fn != nil {
+		fn(g)
+	}
+	return g
+}
+
+// Group 创建嵌套分组, 前缀拼接在当前分组之后, 继承当前分组的中间件
+func (g *Group) Group(prefix string, fn func(g *Group)) *Group {
+	sub := &Group{rc: g.rc, parent: g, prefix: joinPath(g.prefix, prefix)}
+	if fn != nil {
+		fn(sub)
+	}
+	return sub
+}
+
+// Use 添加分组中间件, 作用于分组和子分组中的所有路由, 包括调用 Use 之前注册的路由
+func (g *Group) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+	g.rc.version.Add(1)
+}
+
+// Add 见 RegistorController.Add
+func (g *Group) Add(pattern string, c ControllerInterface, mappingMethods ...string) *Route {
+	return g.addRoute(pattern, controllerHandlers(c, nil, mappingMethods))
+}
+
+// AddFactory 见 RegistorController.AddFactory
+func (g *Group) AddFactory(pattern string, factory func() ControllerInterface, mappingMethods ...string) *Route {
+	return g.addRoute(pattern, controllerHandlers(factory(), factory, mappingMethods))
+}
+
+// Get 见 RegistorController.Handle
+func (g *Group) Get(pattern string, handler interface{}) *Route {
+	return g.Handle(http.MethodGet, pattern, handler)
+}
+
+// Post 见 RegistorController.Handle
+func (g *Group) Post(pattern string, handler interface{}) *Route {
+	return g.Handle(http.MethodPost, pattern, handler)
+}
+
+// Put 见 RegistorController.Handle
+func (g *Group) Put(pattern string, handler interface{}) *Route {
+	return g.Handle(http.MethodPut, pattern, handler)
+}
+
+// Delete 见 RegistorController.Handle
+func (g *Group) Delete(pattern string, handler interface{}) *Route {
+	return g.Handle(http.MethodDelete, pattern, handler)
+}
+
+// Handle 见 RegistorController.Handle
+func (g *Group) Handle(method, pattern string, handler interface{}) *Route {
+	method = strings.ToUpper(method)
+	h := newRouteHandler(method, joinPath(g.prefix, pattern), handler)
+	return g.addRoute(pattern, map[string]*routeHandler{method: h})
+}
+
+// Mount 把 sub 中已经注册的路由挂载到分组的 prefix 之下, 见 RegistorController.Mount
+func (g *Group) Mount(prefix string, sub *RegistorController) {
+	g.rc.mount(g, joinPath(g.prefix, prefix), sub)
+}
+
+func (g *Group) addRoute(pattern string, handlers map[string]*routeHandler) *Route {
+	for _, h := range handlers {
+		h.group = g
+	}
+	return g.rc.addRoute(joinPath(g.prefix, pattern), handlers)
+}
+
+// wrap 用分组及其所有上级分组的中间件包裹 h, 外层分组的中间件在外面
+func (g *Group) wrap(h http.Handler) http.Handler {
+	for ; g != nil; g = g.parent {
+		h = chain(h, g.middlewares)
+	}
+	return h
+}
+
+// depth 返回分组嵌套的层数
+func (g *Group) depth() int {
+	n := 0
+	for ; g != nil; g = g.parent {
+		n++
+	}
+	return n
+}
+
+// wrapGroups 用 handlers 所在分组的中间件包裹 h, 各个请求方法在不同分组中注册时每个分组只包裹一次, 上级分组在外面
+func wrapGroups(h http.Handler, handlers map[string]*routeHandler) http.Handler {
+	var groups []*Group
+	seen := make(map[*Group]bool)
+	for _, m := range httpMethods {
+		rh, ok := handlers[m.method]
+		if !ok {
+			continue
+		}
+		for g := rh.group; g != nil && !seen[g]; g = g.parent {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].depth() > groups[j].depth()
+	})
+	for _, g := range groups {
+		h = chain(h, g.middlewares)
+	}
+	return h
+}
+
+// Mount 把 sub 中已经注册的路由挂载到 prefix 之下, sub 的全局中间件只作用于这些路由.
+// 挂载时复制路由, 路由的名字也一起复制, 与已有的名字重复时 panic. 之后再往 sub 中注册的路由和中间件不会生效.
+func (rc *RegistorController) Mount(prefix string, sub *RegistorController) {
+	rc.mount(nil, joinPath("", prefix), sub)
+}
+
+func (rc *RegistorController) mount(parent *Group, prefix string, sub *RegistorController) {
+	if sub == rc {
+		panic("router: can not mount a router onto itself")
+	}
+
+	// sub 的全局中间件放在挂载点的分组上, sub 中的分组复制到它下面, 同一个分组只复制一次
+	root := &Group{rc: rc, parent: parent, prefix: prefix, middlewares: append([]Middleware{}, sub.middlewares...)}
+	groups := make(map[*Group]*Group)
+	var clone func(g *Group) *Group
+	clone = func(g *Group) *Group {
+		if g == nil {
+			return root
+		}
+		if c, ok := groups[g]; ok {
+			return c
+		}
+		c := &Group{rc: rc, parent: clone(g.parent), prefix: joinPath(prefix, g.prefix), middlewares: append([]Middleware{}, g.middlewares...)}
+		groups[g] = c
+		return c
+	}
+
+	for _, route := range sub.routers {
+		handlers := make(map[string]*routeHandler, len(route.handlers))
+		for method, h := range route.handlers {
+			mounted := *h
+			mounted.middlewares = append([]Middleware{}, h.middlewares...)
+			mounted.group = clone(h.group)
+			handlers[method] = &mounted
+		}
+
+		mounted := rc.addRoute(joinPath(prefix, route.pattern), handlers)
+		if route.name != "" {
+			mounted.Name(route.name)
+		}
+	}
+}
+
+// joinPath 拼接分组前缀和路由, 路由为 "/" 时就是前缀本身
+func joinPath(prefix, pattern string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if pattern == "" || pattern == "/" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+
+	return prefix + "/" + strings.TrimLeft(pattern, "/")
+}
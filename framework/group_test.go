@@ -0,0 +1,210 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var calls []string
+	rc := &RegistorController{}
+	rc.Use(trace("global", &calls))
+	rc.Get("/", func(ctx *Context) {
+		calls = append(calls, "home")
+	})
+
+	rc.Group("/admin", func(g *Group) {
+		g.Get("/", func(ctx *Context) {
+			calls = append(calls, "admin")
+		})
+		g.Group("/users", func(g *Group) {
+			g.Get("/:id", func(ctx *Context) {
+				calls = append(calls, "user "+ctx.Params["id"])
+			}).Use(trace("route", &calls))
+			g.Use(trace("users", &calls))
+		})
+		g.Use(trace("admin", &calls))
+	})
+	rc.Group("/api/v1", func(g *Group) {
+		g.Use(trace("api", &calls))
+		g.Add("/posts", &postsController{}, "get:List")
+	})
+	// 同一个路径的其他方法不受分组中间件影响
+	rc.Post("/api/v1/posts", func(ctx *Context) {
+		calls = append(calls, "create")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		calls  string
+	}{
+		{"GET", "/", "global,home"},
+		{"GET", "/admin", "global,admin,admin"},
+		{"GET", "/admin/users/7", "global,admin,users,route,user 7"},
+		{"GET", "/api/v1/posts", "global,api"},
+		{"POST", "/api/v1/posts", "global,create"},
+		{"GET", "/admin/missing", "global"},
+	}
+	for i, v := range tests {
+		calls = nil
+		serve(rc, v.method, v.path)
+		if got := strings.Join(calls, ","); got != v.calls {
+			t.Fatalf("%v: bad calls for %s %s: got %q, want %q", i+1, v.method, v.path, got, v.calls)
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	var calls []string
+	blog := &RegistorController{}
+	blog.Use(trace("blog", &calls))
+	blog.Get("/posts/:id", func(ctx *Context) {
+		calls = append(calls, "post "+ctx.Params["id"])
+	})
+	blog.Group("/drafts", func(g *Group) {
+		g.Use(trace("drafts", &calls))
+		g.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "drafts")
+		})
+	})
+
+	rc := &RegistorController{}
+	rc.Use(trace("global", &calls))
+	rc.Mount("/blog", blog)
+	rc.Group("/v2", func(g *Group) {
+		g.Use(trace("v2", &calls))
+		g.Mount("/blog", blog)
+	})
+
+	tests := []struct {
+		path  string
+		calls string
+	}{
+		{"/blog/posts/1", "global,blog,post 1"},
+		{"/blog/drafts", "global,blog,drafts,drafts"},
+		{"/v2/blog/posts/2", "global,v2,blog,post 2"},
+		{"/posts/1", "global"},
+	}
+	for i, v := range tests {
+		calls = nil
+		serve(rc, "GET", v.path)
+		if got := strings.Join(calls, ","); got != v.calls {
+			t.Fatalf("%v: bad calls for %s: got %q, want %q", i+1, v.path, got, v.calls)
+		}
+	}
+}
+
+func TestGroupAutoMethods(t *testing.T) {
+	var calls []string
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "auth")
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	rc := &RegistorController{}
+	rc.Group("/api", func(g *Group) {
+		g.Use(CORS(CORSOptions{AllowOrigins: []string{"http://example.com"}}), auth)
+		g.Get("/posts", func(ctx *Context) {})
+		g.Post("/posts", func(ctx *Context) {})
+	})
+
+	tests := []struct {
+		method, origin, auth string
+		code                 int
+		allowOrigin, calls   string
+	}{
+		// 预检请求由分组的 CORS 响应, 不经过认证
+		{"OPTIONS", "http://example.com", "", http.StatusNoContent, "http://example.com", ""},
+		{"OPTIONS", "", "", http.StatusUnauthorized, "", "auth"},
+		{"OPTIONS", "", "token", http.StatusNoContent, "", "auth"},
+		{"DELETE", "http://example.com", "", http.StatusUnauthorized, "http://example.com", "auth"},
+		{"DELETE", "", "token", http.StatusMethodNotAllowed, "", "auth"},
+	}
+	for i, v := range tests {
+		calls = nil
+		r := httptest.NewRequest(v.method, "/api/posts", nil)
+		if v.origin != "" {
+			r.Header.Set("Origin", v.origin)
+			r.Header.Set("Access-Control-Request-Method", "POST")
+		}
+		if v.auth != "" {
+			r.Header.Set("Authorization", v.auth)
+		}
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, r)
+
+		if w.Code != v.code {
+			t.Fatalf("%v: bad code for %s: got %d, want %d", i+1, v.method, w.Code, v.code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != v.allowOrigin {
+			t.Fatalf("%v: bad allow origin: got %q, want %q", i+1, got, v.allowOrigin)
+		}
+		if got := strings.Join(calls, ","); got != v.calls {
+			t.Fatalf("%v: bad calls for %s: got %q, want %q", i+1, v.method, got, v.calls)
+		}
+		if v.code != http.StatusUnauthorized && v.origin == "" && w.Header().Get("Allow") != "GET, HEAD, POST, OPTIONS" {
+			t.Fatalf("%v: bad allow header: got %q", i+1, w.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestMountRoute(t *testing.T) {
+	var calls []string
+	blog := &RegistorController{}
+	blog.Get("/posts/:id", func(ctx *Context) {
+		calls = append(calls, "post "+ctx.Params["id"])
+	}).Use(trace("route", &calls)).Name("post")
+
+	rc := &RegistorController{}
+	rc.Post("/blog/posts/:id", func(ctx *Context) {
+		calls = append(calls, "update "+ctx.Params["id"])
+	})
+	rc.Mount("/blog", blog)
+
+	// 挂载的路由中间件不作用于同一个路径上已经注册的方法
+	tests := []struct {
+		method string
+		calls  string
+	}{
+		{"GET", "route,post 1"},
+		{"POST", "update 1"},
+	}
+	for i, v := range tests {
+		calls = nil
+		serve(rc, v.method, "/blog/posts/1")
+		if got := strings.Join(calls, ","); got != v.calls {
+			t.Fatalf("%v: bad calls for %s: got %q, want %q", i+1, v.method, got, v.calls)
+		}
+	}
+
+	// 路由的名字一起挂载
+	if u, err := rc.URLFor("post", "id", 2); err != nil || u != "/blog/posts/2" {
+		t.Fatalf("bad mounted url: got %q, %v", u, err)
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		prefix, pattern, path string
+	}{
+		{"", "", "/"},
+		{"", "/", "/"},
+		{"/admin", "/", "/admin"},
+		{"/admin/", "users", "/admin/users"},
+		{"/admin", "/users/:id", "/admin/users/:id"},
+	}
+	for i, v := range tests {
+		if got := joinPath(v.prefix, v.pattern); got != v.path {
+			t.Fatalf("%v: bad path: got %q, want %q", i+1, got, v.path)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// 请求处理者
+// 注册时就把控制器的创建方式和处理方法准备好, 处理请求时不再通过 MethodByName 查找方法.
+package framework
+
+import (
+	"reflect"
+	"sync"
+)
+
+// routeHandler 是某个请求方法的处理者, 控制器方法或者普通函数二选一
+type routeHandler struct {
+	controllerType reflect.Type
+	methodName     string                     // 控制器中处理请求的方法名
+	newController  func() ControllerInterface // 创建控制器, 默认反射创建零值控制器
+	invoke         func(ControllerInterface)  // 调用处理方法
+	pool           *sync.Pool                 // 不为空时复用控制器, 见 Route.Pool
+
+	fn          func(*Context) error
+	group       *Group       // 注册时所在的分组
+	middlewares []Middleware // 路由中间件, 见 Route.Use
+}
+
+// verbInvokers 调用控制器的 Get, Post 等处理方法, 通过接口断言直接调用, 不需要反射
+var verbInvokers = map[string]func(ControllerInterface){
+	"Get":     func(c ControllerInterface) { c.(interface{ Get() }).Get() },
+	"Post":    func(c ControllerInterface) { c.(interface{ Post() }).Post() },
+	"Delete":  func(c ControllerInterface) { c.(interface{ Delete() }).Delete() },
+	"Put":     func(c ControllerInterface) { c.(interface{ Put() }).Put() },
+	"Head":    func(c ControllerInterface) { c.(interface{ Head() }).Head() },
+	"Patch":   func(c ControllerInterface) { c.(interface{ Patch() }).Patch() },
+	"Options": func(c ControllerInterface) { c.(interface{ Options() }).Options() },
+}
+
+// newControllerHandler 生成调用控制器 t 的 name 方法的处理者, 方法不存在时 panic
+func newControllerHandler(t reflect.Type, factory func() ControllerInterface, name string) *routeHandler {
+	h := &routeHandler{
+		controllerType: t,
+		methodName:     name,
+		newController:  factory,
+	}
+
+	if h.newController == nil {
+		h.newController = func() ControllerInterface {
+			return reflect.New(t).Interface().(ControllerInterface)
+		}
+	}
+
+	if !hasHandler(t, name) {
+		panic("router: " + t.String() + " has no method " + name + "()")
+	}
+	if invoke, ok := verbInvokers[name]; ok {
+		h.invoke = invoke
+		return h
+	}
+
+	m, _ := reflect.PtrTo(t).MethodByName(name)
+	fn := m.Func
+	h.invoke = func(c ControllerInterface) {
+		fn.Call([]reflect.Value{reflect.ValueOf(c)})
+	}
+
+	return h
+}
+
+// Pool 复用这次注册的控制器, 减少每个请求的内存分配.
+// 放回池子之前只清空内嵌的 Controller, 子类自己的字段需要在 Prepare 中重置,
+// 请求结束之后也不能再持有控制器.
+func (route *Route) Pool() *Route {
+	for _, h := range route.registered {
+		if h.newController != nil && h.pool == nil {
+			h := h
+			h.pool = &sync.Pool{New: func() interface{} { return h.newController() }}
+		}
+	}
+	return route
+}
+
+func (h *routeHandler) acquire() ControllerInterface {
+	if h.pool != nil {
+		return h.pool.Get().(ControllerInterface)
+	}
+	return h.newController()
+}
+
+func (h *routeHandler) release(c ControllerInterface) {
+	if h.pool == nil {
+		return
+	}
+
+	// 没法清空的控制器不能复用
+	if r, ok := c.(resetter); ok {
+		r.reset()
+		h.pool.Put(c)
+	}
+}
+
+// runController 执行控制器的生命周期: Init, Prepare, 处理方法, Render, Finish.
+// Prepare 或处理方法中调用 Abort, Redirect, StopRun 会跳过后续步骤, Finish 总会执行, 即使发生了 panic.
+func runController(h *routeHandler, ctx *Context) error {
+	c := h.acquire()
+	defer h.release(c)
+
+	c.Init(ctx, h.controllerType.Name())
+	if s, ok := c.(methodNameSetter); ok {
+		s.setMethodName(h.methodName)
+	}
+	defer c.Finish()
+
+	c.Prepare()
+	if stopped, err := isStopped(c); stopped {
+		return err
+	}
+
+	h.invoke(c)
+	if stopped, err := isStopped(c); stopped {
+		return err
+	}
+
+	return c.Render()
+}
@@ -0,0 +1,343 @@
+// 中间件
+// 路由匹配之后按 全局 -> 分组(外层分组在前) -> 路由 的顺序执行, 同一层按注册顺序由外到内包裹处理者.
+// 中间件不调用 next 就可以直接结束请求.
+package framework
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Middleware func(http.Handler) http.Handler
+
+// Use 添加全局中间件, 对所有请求生效, 包括静态文件和 404
+func (rc *RegistorController) Use(middlewares ...Middleware) {
+	rc.middlewares = append(rc.middlewares, middlewares...)
+	rc.version.Add(1)
+}
+
+// Use 添加只作用于这次注册的请求方法的中间件, 在全局和分组中间件之后执行.
+// 同一个路径上另外注册的请求方法不受影响.
+func (route *Route) Use(middlewares ...Middleware) *Route {
+	for _, h := range route.registered {
+		h.middlewares = append(h.middlewares, middlewares...)
+	}
+	route.router.version.Add(1)
+	return route
+}
+
+// chain 用 middlewares 包裹 h, middlewares[0] 在最外层
+func chain(h http.Handler, middlewares []Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// chainCache 缓存包裹好中间件的 handler, 中间件只在第一次用到时创建一次, 而不是每个请求创建一次.
+// 注册路由或者添加中间件时 RegistorController.version 增加, 缓存随之失效.
+type chainCache struct {
+	mu       sync.RWMutex
+	version  uint64
+	handlers map[string]http.Handler
+}
+
+// get 返回 key 对应的 handler, 没有缓存或者缓存已经失效时用 build 创建
+func (c *chainCache) get(version *atomic.Uint64, key string, build func() http.Handler) http.Handler {
+	v := version.Load()
+	c.mu.RLock()
+	h, ok := c.handlers[key]
+	ok = ok && c.version == v
+	c.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != v || c.handlers == nil {
+		c.version, c.handlers = v, make(map[string]http.Handler)
+	}
+	if h, ok := c.handlers[key]; ok {
+		return h
+	}
+	h = build()
+	c.handlers[key] = h
+	return h
+}
+
+// statusWriter 记录响应的状态码和长度
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Logger 记录每个请求的方法, 路径, 状态码, 响应长度和耗时
+func Logger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		log.Printf("%s %s %d %d %s", r.Method, r.URL.RequestURI(), sw.status, sw.size, time.Since(start))
+	})
+}
+
+// Recovery 捕获处理请求时的 panic, 记录堆栈并返回 500
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				log.Printf("panic: %v\n%s", err, debug.Stack())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestIDHeader 是 RequestID 读写的请求头
+const RequestIDHeader = "X-Request-Id"
+
+// RequestID 给请求分配一个 id, 客户端带了就沿用, 同时写到请求头和响应头中
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			b := make([]byte, 16)
+			if _, err := io.ReadFull(rand.Reader, b); err != nil {
+				id = strconv.FormatInt(time.Now().UnixNano(), 10)
+			} else {
+				id = hex.EncodeToString(b)
+			}
+			r.Header.Set(RequestIDHeader, id)
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+var gzipPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// gzipWriter 在写第一个字节时决定是否压缩, 已经编码过的响应和没有响应体的状态码不压缩
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if h.Get("Content-Encoding") == "" && code != http.StatusNoContent && code != http.StatusNotModified && code >= http.StatusOK {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+
+		w.gz = gzipPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		// 压缩之后 net/http 就没法根据内容猜类型了
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+		gzipPool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// Gzip 对接受 gzip 编码的客户端压缩响应体
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsEncoding(r, "gzip") || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(name), encoding) {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// CORSOptions 跨域配置, 零值字段使用默认值
+type CORSOptions struct {
+	AllowOrigins     []string // 允许的 Origin, "*" 表示任意, 默认任意
+	AllowMethods     []string // 预检请求允许的方法, 默认 GET, HEAD, POST, PUT, PATCH, DELETE
+	AllowHeaders     []string // 预检请求允许的请求头, 默认回显 Access-Control-Request-Headers
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration // 预检结果的缓存时间
+}
+
+// CORS 处理跨域请求, 预检请求直接返回 204 不再往下执行
+func CORS(opts CORSOptions) Middleware {
+	if len(opts.AllowOrigins) == 0 {
+		opts.AllowOrigins = []string{"*"}
+	}
+	if len(opts.AllowMethods) == 0 {
+		opts.AllowMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+
+	allowMethods := strings.Join(opts.AllowMethods, ", ")
+	allowHeaders := strings.Join(opts.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(opts.ExposeHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			allowed, anyOrigin := false, false
+			for _, o := range opts.AllowOrigins {
+				if o == "*" {
+					allowed, anyOrigin = true, true
+				} else if strings.EqualFold(o, origin) {
+					allowed = true
+				}
+			}
+			if origin == "" || !allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin && !opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+				h.Set("Access-Control-Allow-Methods", allowMethods)
+
+				if allowHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", allowHeaders)
+				} else if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+					h.Set("Access-Control-Allow-Headers", reqHeaders)
+				}
+				if opts.MaxAge > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge/time.Second)))
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timeout 限制请求的处理时间, 超时返回 503, request 的 context 同时会被取消
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.TimeoutHandler(next, d, http.StatusText(http.StatusServiceUnavailable))
+	}
+}
@@ -0,0 +1,210 @@
+package framework
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func trace(name string, out *[]string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*out = append(*out, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	rc := &RegistorController{}
+	rc.Use(trace("global1", &calls), trace("global2", &calls))
+	rc.Get("/users/:id", func(ctx *Context) {
+		calls = append(calls, "handler "+ctx.Params["id"])
+	}).Use(trace("route", &calls), func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls = append(calls, "param "+FromRequest(r).Params["id"])
+			next.ServeHTTP(w, r)
+		})
+	})
+	// 路由中间件只作用于注册时的请求方法
+	rc.Post("/users/:id", func(ctx *Context) {
+		calls = append(calls, "update "+ctx.Params["id"])
+	})
+
+	serve(rc, "GET", "/users/42")
+	want := "global1,global2,route,param 42,handler 42"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("bad call order: got %q, want %q", got, want)
+	}
+
+	calls = nil
+	serve(rc, "POST", "/users/42")
+	if got := strings.Join(calls, ","); got != "global1,global2,update 42" {
+		t.Fatalf("route middleware should not wrap other methods: got %q", got)
+	}
+
+	calls = nil
+	serve(rc, "GET", "/missing")
+	if got := strings.Join(calls, ","); got != "global1,global2" {
+		t.Fatalf("global middleware should wrap 404: got %q", got)
+	}
+}
+
+// counter 记录中间件被创建的次数和中间件实例处理过的请求数
+func counter(built *int, served *[]int) Middleware {
+	return func(next http.Handler) http.Handler {
+		*built++
+		n := 0
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n++
+			*served = append(*served, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareBuiltOnce(t *testing.T) {
+	var globalBuilt, groupBuilt, routeBuilt int
+	var global, group, route []int
+	rc := &RegistorController{}
+	rc.Use(counter(&globalBuilt, &global))
+	rc.Group("/api", func(g *Group) {
+		g.Use(counter(&groupBuilt, &group))
+		g.Get("/users", func(ctx *Context) {}).Use(counter(&routeBuilt, &route))
+	})
+
+	for i := 0; i < 3; i++ {
+		serve(rc, "GET", "/api/users")
+	}
+	if globalBuilt != 1 || groupBuilt != 1 || routeBuilt != 1 {
+		t.Fatalf("middleware built more than once: global %d, group %d, route %d", globalBuilt, groupBuilt, routeBuilt)
+	}
+	if want := "[1 2 3]"; fmt.Sprint(global) != want || fmt.Sprint(group) != want || fmt.Sprint(route) != want {
+		t.Fatalf("bad counts: global %v, group %v, route %v, want %v", global, group, route, want)
+	}
+
+	// 添加中间件之后重新创建
+	var laterBuilt int
+	var later []int
+	rc.Use(counter(&laterBuilt, &later))
+	serve(rc, "GET", "/api/users")
+	serve(rc, "GET", "/api/users")
+	if laterBuilt != 1 || fmt.Sprint(later) != "[1 2]" || globalBuilt != 2 {
+		t.Fatalf("bad rebuild: later built %d, served %v, global built %d", laterBuilt, later, globalBuilt)
+	}
+
+	// 404 和没有注册的方法也只创建一次, 没有注册的方法共用一个 405 handler
+	globalBuilt = 0
+	for _, method := range []string{"GET", "POST", "PROPFIND"} {
+		serve(rc, method, "/missing")
+		serve(rc, method, "/api/users")
+	}
+	if globalBuilt != 2 {
+		t.Fatalf("bad global builds for 404 and 405: got %d, want 2", globalBuilt)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	})
+	rc.Get("/", func(ctx *Context) {
+		t.Fatal("handler should not run")
+	})
+
+	if w := serve(rc, "GET", "/"); w.Code != http.StatusForbidden {
+		t.Fatalf("bad status: got %v, want %v", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestRecoveryAndRequestID(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Use(RequestID, Recovery)
+	rc.Get("/panic", func(ctx *Context) {
+		panic("boom")
+	})
+
+	w := serve(rc, "GET", "/panic")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("bad status: got %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+	if len(w.Header().Get(RequestIDHeader)) != 32 {
+		t.Fatalf("bad request id: %q", w.Header().Get(RequestIDHeader))
+	}
+
+	r := httptest.NewRequest("GET", "/panic", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, r)
+	if got := w.Header().Get(RequestIDHeader); got != "abc" {
+		t.Fatalf("request id should be reused: got %q", got)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	body := strings.Repeat("hello gzip ", 100)
+	rc := &RegistorController{}
+	rc.Use(Gzip)
+	rc.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("response should be gzip encoded")
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("bad content type: %q", w.Header().Get("Content-Type"))
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal("bad gzip body: ", err)
+	}
+	if b, _ := io.ReadAll(gz); string(b) != body {
+		t.Fatalf("bad body: got %q", b)
+	}
+
+	if w := serve(rc, "GET", "/"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Fatal("response should not be encoded without Accept-Encoding")
+	}
+}
+
+func TestCORS(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Use(CORS(CORSOptions{AllowOrigins: []string{"http://example.com"}, AllowCredentials: true}))
+	rc.Post("/api", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	r := httptest.NewRequest("OPTIONS", "/api", nil)
+	r.Header.Set("Origin", "http://example.com")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("bad preflight status: got %v", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "http://example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("bad preflight headers: %v", w.Header())
+	}
+
+	r = httptest.NewRequest("POST", "/api", nil)
+	r.Header.Set("Origin", "http://evil.com")
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Body.String() != "ok" {
+		t.Fatalf("unknown origin should not get CORS headers: %v", w.Header())
+	}
+}
@@ -0,0 +1,308 @@
+// JSON, JSONP, XML, YAML 响应和内容协商
+// 这些方法直接把数据编码到响应中, 输出之后结束请求, 不再自动渲染模板.
+// 编码失败且还没有写出任何内容时, 路由按 500 渲染错误页面.
+package framework
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServeJSON 以 JSON 输出 data, data 为 nil 时输出 c.Data. status 可选, 默认 200.
+func (c *Controller) ServeJSON(data interface{}, status ...int) {
+	c.serve("application/json; charset=utf-8", status, func(w io.Writer) error {
+		return c.encodeJSON(w, data)
+	})
+}
+
+// jsonpCallback 限制 JSONP 回调函数名, 防止通过 callback 参数注入脚本
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+// ServeJSONP 以 JSONP 输出 data, 回调函数名取自 query 参数 callback.
+// 没有 callback 时同 ServeJSON, callback 不合法时返回 400.
+func (c *Controller) ServeJSONP(data interface{}, status ...int) {
+	callback := c.Ctx.Request.URL.Query().Get("callback")
+	if callback == "" {
+		c.ServeJSON(data, status...)
+		return
+	}
+	if !jsonpCallback.MatchString(callback) {
+		c.abortErr = NewHTTPError(http.StatusBadRequest, "invalid jsonp callback")
+		c.stopped = true
+		return
+	}
+
+	c.Ctx.ResponseWriter.Header().Set("X-Content-Type-Options", "nosniff")
+	c.serve("application/javascript; charset=utf-8", status, func(w io.Writer) error {
+		// 开头的注释防止 Rosetta Flash 一类把响应当成其他格式的攻击
+		if _, err := io.WriteString(w, "/**/"+callback+"("); err != nil {
+			return err
+		}
+		if err := c.encodeJSON(w, data); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, ");")
+		return err
+	})
+}
+
+// ServeXML 以 XML 输出 data, map 的根元素是 <response>, 每个键是一个子元素
+func (c *Controller) ServeXML(data interface{}, status ...int) {
+	c.serve("application/xml; charset=utf-8", status, func(w io.Writer) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+
+		enc := xml.NewEncoder(w)
+		if c.PrettyPrint {
+			enc.Indent("", "  ")
+		}
+
+		v := c.normalize(data)
+		if m, ok := v.(map[string]interface{}); ok {
+			err := enc.EncodeElement(xmlMap(m), xml.StartElement{Name: xml.Name{Local: "response"}})
+			if err != nil {
+				return err
+			}
+		} else if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Flush()
+	})
+}
+
+// ServeYAML 以 YAML 输出 data
+func (c *Controller) ServeYAML(data interface{}, status ...int) {
+	c.serve("application/yaml; charset=utf-8", status, func(w io.Writer) error {
+		return NewYAMLEncoder(w).Encode(c.normalize(data))
+	})
+}
+
+// negotiateOffers 是 Negotiate 支持的格式, 客户端权重相同时按这里的顺序选择
+var negotiateOffers = []string{
+	"application/json",
+	"application/xml",
+	"text/xml",
+	"application/yaml",
+	"application/x-yaml",
+	"text/yaml",
+	"text/html",
+}
+
+// Negotiate 按 Accept 头选择输出格式: JSON, XML, YAML 或 HTML.
+// 没有 Accept 头时输出 JSON; 选中 text/html 时不输出, data 放进 c.Data["Data"] 交给 Render 渲染模板,
+// 状态码由 Render 发出;
+// 没有可接受的格式时返回 406.
+func (c *Controller) Negotiate(data interface{}, status ...int) {
+	c.Ctx.ResponseWriter.Header().Add("Vary", "Accept")
+
+	switch negotiate(c.Ctx.Request.Header.Get("Accept"), negotiateOffers) {
+	case "application/json":
+		c.ServeJSON(data, status...)
+	case "application/xml", "text/xml":
+		c.ServeXML(data, status...)
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		c.ServeYAML(data, status...)
+	case "text/html":
+		if data != nil {
+			c.Data["Data"] = data
+		}
+		if len(status) > 0 {
+			c.status = status[0]
+		}
+	default:
+		c.abortErr = NewHTTPError(http.StatusNotAcceptable, "")
+		c.stopped = true
+	}
+}
+
+// serve 设置 Content-Type 并调用 encode 输出响应, 状态码在写第一个字节时才发出,
+// 这样编码失败时还能改成错误页面
+func (c *Controller) serve(contentType string, status []int, encode func(w io.Writer) error) {
+	c.stopped = true
+
+	code := http.StatusOK
+	if len(status) > 0 {
+		code = status[0]
+	}
+
+	c.Ctx.ResponseWriter.Header().Set("Content-Type", contentType)
+	w := &headerWriter{ResponseWriter: c.Ctx.ResponseWriter, code: code}
+	if err := encode(w); err != nil {
+		c.abortErr = err
+		return
+	}
+	if !w.wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (c *Controller) encodeJSON(w io.Writer, data interface{}) error {
+	enc := json.NewEncoder(w)
+	if c.PrettyPrint {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(c.normalize(data))
+}
+
+// normalize data 为 nil 时换成 c.Data, 再把其中的 map[interface{}]interface{} 转换成可以编码的 map[string]interface{}
+func (c *Controller) normalize(data interface{}) interface{} {
+	if data == nil {
+		data = c.Data
+	}
+	return stringKeys(data)
+}
+
+// stringKeys 递归地把 map[interface{}]interface{} 转成 map[string]interface{}, 键用 fmt.Sprint 转成字符串
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = stringKeys(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = stringKeys(value)
+		}
+		return s
+	}
+	return v
+}
+
+// headerWriter 在第一次写的时候才发出状态码
+type headerWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// xmlMap 让 map 可以编码成 XML, 键按字母排序, 不是合法元素名的键输出成 <entry key="...">
+type xmlMap map[string]interface{}
+
+var xmlName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.\-]*$`)
+
+func (m xmlMap) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		el := xml.StartElement{Name: xml.Name{Local: key}}
+		if !xmlName.MatchString(key) || strings.HasPrefix(strings.ToLower(key), "xml") {
+			el = xml.StartElement{
+				Name: xml.Name{Local: "entry"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+			}
+		}
+		if err := encodeXMLValue(e, el, m[key]); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// encodeXMLValue 编码一个值, 切片的每个元素都用 start 输出
+func encodeXMLValue(e *xml.Encoder, start xml.StartElement, v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return e.EncodeElement(xmlMap(v), start)
+	case []interface{}:
+		for _, item := range v {
+			if err := encodeXMLValue(e, start, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.EncodeElement(v, start)
+}
+
+// negotiate 返回 offers 中客户端最想要的类型, 都不接受时返回空字符串.
+// 每个类型的权重取 Accept 中最具体的匹配项的 q 值, 权重相同时 offers 中靠前的优先.
+func negotiate(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	type mediaRange struct {
+		typ, subtype string
+		q            float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		media, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(media)), "/")
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				if f, err := strconv.ParseFloat(value, 64); err == nil {
+					q = f
+				}
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		typ, subtype, _ := strings.Cut(offer, "/")
+
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*" && r.subtype == "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
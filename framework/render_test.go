@@ -0,0 +1,222 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type renderController struct {
+	Controller
+}
+
+func (c *renderController) Get() {
+	c.Data["title"] = "hello"
+	c.Data[1] = []interface{}{map[interface{}]interface{}{"id": 1}}
+
+	q := c.Ctx.Request.URL.Query()
+	c.PrettyPrint = q.Get("pretty") != ""
+
+	var data interface{}
+	if q.Get("bad") != "" {
+		data = map[string]interface{}{"ch": make(chan int)}
+	}
+
+	switch q.Get("format") {
+	case "json":
+		c.ServeJSON(data, http.StatusCreated)
+	case "jsonp":
+		c.ServeJSONP(data)
+	case "xml":
+		c.ServeXML(data)
+	case "yaml":
+		c.ServeYAML(data)
+	default:
+		c.Negotiate(data)
+	}
+}
+
+func TestServeFormats(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Add("/", &renderController{})
+
+	tests := []struct {
+		target      string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/?format=json", "", 201, "application/json; charset=utf-8", `{"1":[{"id":1}],"title":"hello"}` + "\n"},
+		{"/?format=json&pretty=1", "", 201, "application/json; charset=utf-8", "{\n  \"1\": [\n    {\n      \"id\": 1\n    }\n  ],\n  \"title\": \"hello\"\n}\n"},
+		{"/?format=json&bad=1", "", 500, "text/plain; charset=utf-8", "Internal Server Error\n"},
+		{"/?format=jsonp&callback=app.cb", "", 200, "application/javascript; charset=utf-8", `/**/app.cb({"1":[{"id":1}],"title":"hello"}` + "\n);"},
+		{"/?format=jsonp&callback=alert(1)", "", 400, "text/plain; charset=utf-8", "invalid jsonp callback\n"},
+		{"/?format=jsonp", "", 200, "application/json; charset=utf-8", `{"1":[{"id":1}],"title":"hello"}` + "\n"},
+		{"/?format=xml", "", 200, "application/xml; charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><entry key="1"><id>1</id></entry><title>hello</title></response>`},
+		{"/?format=yaml", "", 200, "application/yaml; charset=utf-8", "\"1\":\n  - id: 1\ntitle: hello\n"},
+		{"/", "", 200, "application/json; charset=utf-8", `{"1":[{"id":1}],"title":"hello"}` + "\n"},
+		{"/", "application/xml;q=0.9, application/yaml", 200, "application/yaml; charset=utf-8", "\"1\":\n  - id: 1\ntitle: hello\n"},
+		{"/", "text/*;q=0.5, */*;q=0.1", 200, "application/xml; charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><entry key="1"><id>1</id></entry><title>hello</title></response>`},
+		{"/", "text/html,application/xhtml+xml,*/*;q=0.8", 200, "", ""},
+		{"/", "application/json;q=0, */*", 200, "application/xml; charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<response><entry key="1"><id>1</id></entry><title>hello</title></response>`},
+		{"/", "image/png", 406, "text/plain; charset=utf-8", "Not Acceptable\n"},
+	}
+
+	for i, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%v: bad code: got %d, want %d", i+1, w.Code, tt.code)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Fatalf("%v: bad content type: got %q, want %q", i+1, got, tt.contentType)
+		}
+		if got := w.Body.String(); got != tt.body {
+			t.Fatalf("%v: bad body: got %q, want %q", i+1, got, tt.body)
+		}
+	}
+}
+
+type negotiateController struct {
+	Controller
+}
+
+func (c *negotiateController) Get() {
+	if c.Ctx.Request.URL.Query().Get("broken") != "" {
+		c.TplNames = "broken.html"
+	}
+	c.Negotiate(map[string]interface{}{"name": "alice"}, http.StatusCreated)
+}
+
+func TestNegotiateHTML(t *testing.T) {
+	dir := t.TempDir()
+	writeViews(t, dir, map[string]string{
+		"negotiateController/Get.html": `<p>{{.Data.name}}</p>`,
+		"broken.html":                  `<p>{{template "missing.html"}}</p>`,
+	})
+	views, err := NewViewEngine(dir, nil)
+	if err != nil {
+		t.Fatal("load views fail: ", err)
+	}
+	rc := &RegistorController{Views: views}
+	rc.Add("/", &negotiateController{})
+
+	tests := []struct {
+		target      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/", 201, "text/html; charset=utf-8", "<p>alice</p>"},
+		// 模板出错时还没有发出状态码, 可以渲染错误页面
+		{"/?broken=1", 500, "text/plain; charset=utf-8", "Internal Server Error\n"},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest("GET", tt.target, nil)
+		r.Header.Set("Accept", "text/html")
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%v: bad code: got %d, want %d", i+1, w.Code, tt.code)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Fatalf("%v: bad content type: got %q, want %q", i+1, got, tt.contentType)
+		}
+		if got := w.Body.String(); got != tt.body {
+			t.Fatalf("%v: bad body: got %q, want %q", i+1, got, tt.body)
+		}
+	}
+}
+
+func TestNegotiateVary(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Add("/", &renderController{})
+
+	w := serve(rc, "GET", "/")
+	if got := w.Header().Get("Vary"); got != "Accept" {
+		t.Fatalf("bad vary: got %q, want %q", got, "Accept")
+	}
+}
+
+type yamlUser struct {
+	Name    string            `json:"name"`
+	Email   string            `yaml:"mail,omitempty"`
+	Secret  string            `yaml:"-"`
+	Tags    []string          `yaml:"tags"`
+	Meta    map[string]string `yaml:"meta"`
+	Created time.Time
+	Next    *yamlUser
+	Age     int
+	private int
+}
+
+func TestYAMLEncoder(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, "null\n"},
+		{"plain", "plain\n"},
+		{"", "\"\"\n"},
+		{"yes", "\"yes\"\n"},
+		{"12", "\"12\"\n"},
+		{"a: b", "\"a: b\"\n"},
+		{"- x", "\"- x\"\n"},
+		{"two\nlines", "\"two\\nlines\"\n"},
+		{3.5, "3.5\n"},
+		{[]int{}, "[]\n"},
+		{map[string]int{}, "{}\n"},
+		{[]interface{}{1, "a", []int{2, 3}}, "- 1\n- a\n-\n  - 2\n  - 3\n"},
+		{[]map[string]int{{"a": 1, "b": 2}}, "- a: 1\n  b: 2\n"},
+		{
+			yamlUser{Name: "hyl", Secret: "x", Tags: []string{"go"}, Meta: map[string]string{"b": "2", "a": "1"}, Created: created, Age: 18},
+			"name: hyl\ntags:\n  - go\nmeta:\n  a: \"1\"\n  b: \"2\"\ncreated: 2020-01-02T03:04:05Z\nnext: null\nage: 18\n",
+		},
+		{
+			map[interface{}]interface{}{"user": &yamlUser{Name: "a", Email: "a@b.c"}},
+			"user:\n  name: a\n  mail: a@b.c\n  tags: []\n  meta: {}\n  created: 0001-01-01T00:00:00Z\n  next: null\n  age: 0\n",
+		},
+	}
+
+	for i, tt := range tests {
+		var b strings.Builder
+		if err := NewYAMLEncoder(&b).Encode(tt.in); err != nil {
+			t.Fatalf("%v: encode: %v", i+1, err)
+		}
+		if got := b.String(); got != tt.want {
+			t.Fatalf("%v: bad yaml: got %q, want %q", i+1, got, tt.want)
+		}
+	}
+
+	if err := NewYAMLEncoder(&strings.Builder{}).Encode(make(chan int)); err == nil {
+		t.Fatalf("encode chan: want error")
+	}
+
+	// 循环引用返回错误, 同一个值出现多次不算循环
+	user := &yamlUser{Name: "a"}
+	user.Next = user
+	m := map[string]interface{}{}
+	m["self"] = m
+	s := []interface{}{nil}
+	s[0] = s
+	for i, v := range []interface{}{user, m, s} {
+		if err := NewYAMLEncoder(&strings.Builder{}).Encode(v); err == nil || !strings.Contains(err.Error(), "cycle") {
+			t.Fatalf("%v: bad cycle error: got %v", i+1, err)
+		}
+	}
+	shared := &yamlUser{Name: "a"}
+	if err := NewYAMLEncoder(&strings.Builder{}).Encode([]*yamlUser{shared, {Name: "b", Next: shared}}); err != nil {
+		t.Fatalf("encode shared pointer: %v", err)
+	}
+}
@@ -4,162 +4,436 @@
 package framework
 
 import (
+	"context"
 	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync/atomic"
 )
 
 type Registor interface {
-	Add(pattern string, c ControllerInterface)
+	Add(pattern string, c ControllerInterface, mappingMethods ...string) *Route
 }
 
+// httpMethods 请求方法与 ControllerInterface 中处理方法的对应关系, 顺序即 Allow 头的顺序
+var httpMethods = []struct {
+	method string
+	name   string
+}{
+	{http.MethodGet, "Get"},
+	{http.MethodHead, "Head"},
+	{http.MethodPost, "Post"},
+	{http.MethodPut, "Put"},
+	{http.MethodPatch, "Patch"},
+	{http.MethodDelete, "Delete"},
+	{http.MethodOptions, "Options"},
+}
+
+// Route 是注册路由时返回的句柄, 同一个 pattern 上的各次注册共享 routePath.
+// Use 和 Pool 只作用于这次注册的请求方法.
 type Route struct {
-	regexp *regexp.Regexp			// register router's regexp
-	params map[int]string			// params value
-	controllerType reflect.Type
+	*routePath
+	registered []*routeHandler // 这次注册的处理者
+}
+
+type routePath struct {
+	router   *RegistorController
+	name     string
+	pattern  string
+	segments []segment
+	regexp   *regexp.Regexp           // register router's regexp
+	params   []string                 // params name, 与子匹配的顺序一致
+	handlers map[string]*routeHandler // request method: handler
+	allow    string                   // Allow 头
+	chains   chainCache               // request method: 包裹好全部中间件的 handler
 }
 
 type RegistorController struct {
-	routers []*Route
+	routers     []*Route
+	names       map[string]*Route // 命名路由, 用于生成 URL
+	tree        *node
+	middlewares []Middleware // 全局中间件
+	errorPages  map[int]*template.Template
+	version     atomic.Uint64 // 注册路由和中间件时增加, 使 chains 失效
+	notFounds   chainCache    // 包裹好全局中间件的 404 handler
+
+	// NotFound 处理没有匹配到路由的请求, 为空时渲染 404 错误页面
+	NotFound http.Handler
+	// ErrorHandler 替换默认的错误处理, 见 HandleError
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+	// DevMode 开发模式, 错误页面会展示错误, 堆栈, 请求和路由参数
+	DevMode bool
+	// Views 控制器渲染模板使用的模板引擎
+	Views *ViewEngine
+	// ParamsInQuery 兼容旧代码, 把路由参数加到 URL 的 query 前面, 可以用 r.URL.Query().Get("id") 读取.
+	// 原来的 query 原样保留, 请求中有同名参数时路由参数优先.
+	ParamsInQuery bool
+	// MaxBodySize 限制 Bind 和 FormFile 读取的请求体大小, 超过时返回 413 错误.
+	// 为 0 时使用 DefaultMaxBodySize, 小于 0 时不限制. Upload 按 UploadOptions.MaxSize 限制.
+	MaxBodySize int64
 }
 
-func (rc *RegistorController) Add(pattern string, c ControllerInterface) {
-	if len(pattern) == 0 {
-		panic("register pattern can not null")
-	}
+// Add 注册控制器. 不指定 mappingMethods 时按请求方法调用控制器的 Get, Post 等方法;
+// 指定时按映射调用, 例如 "get:List;post:Create", "get,post:Save", "*:Any".
+func (rc *RegistorController) Add(pattern string, c ControllerInterface, mappingMethods ...string) *Route {
+	return rc.addRoute(pattern, controllerHandlers(c, nil, mappingMethods))
+}
 
-	parts := strings.Split(pattern, "/")
-	params := make(map[int]string)
-	j := 0
-	for i, part := range parts {
-		if strings.HasPrefix(part, ":") {
-			expr := "[^/]+"
+// AddFactory 同 Add, 但是由 factory 创建控制器, 而不是每个请求反射创建一个零值控制器,
+// 可以用来给控制器注入依赖.
+func (rc *RegistorController) AddFactory(pattern string, factory func() ControllerInterface, mappingMethods ...string) *Route {
+	return rc.addRoute(pattern, controllerHandlers(factory(), factory, mappingMethods))
+}
+
+// controllerHandlers 按 mappingMethods 生成控制器各个请求方法的处理者
+func controllerHandlers(c ControllerInterface, factory func() ControllerInterface, mappingMethods []string) map[string]*routeHandler {
+	t := reflect.Indirect(reflect.ValueOf(c)).Type()
+	handlers := make(map[string]*routeHandler)
 
-			if index := strings.Index(part, "("); index != -1 {
-				expr = part[index:]
-				part = part[1:index]
+	if len(mappingMethods) == 0 {
+		for _, m := range httpMethods {
+			if hasHandler(t, m.name) {
+				handlers[m.method] = newControllerHandler(t, factory, m.name)
 			}
+		}
+	}
 
-			parts[i] = expr
+	for _, mapping := range mappingMethods {
+		for _, item := range strings.Split(mapping, ";") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
 
-			params[j] = part
-			j++
+			colon := strings.Index(item, ":")
+			if colon == -1 {
+				panic("router: bad method mapping " + item + ", want method:FuncName")
+			}
+			methods, name := item[:colon], strings.TrimSpace(item[colon+1:])
+
+			h := newControllerHandler(t, factory, name)
+			for _, method := range strings.Split(methods, ",") {
+				method = strings.ToUpper(strings.TrimSpace(method))
+				if method == "*" {
+					for _, m := range httpMethods {
+						handlers[m.method] = h
+					}
+					continue
+				}
+
+				if !isHTTPMethod(method) {
+					panic("router: unknown http method " + method + " in " + item)
+				}
+				handlers[method] = h
+			}
 		}
-
 	}
 
-	pattern = strings.Join(parts, "/")
-	regex, regexpErr := regexp.Compile(pattern)
-	if regexpErr != nil {
-		panic(regexpErr)
-	}
+	return handlers
+}
 
-	t := reflect.Indirect(reflect.ValueOf(c)).Type()
+// Get 注册 GET 请求的处理函数, 见 Handle
+func (rc *RegistorController) Get(pattern string, handler interface{}) *Route {
+	return rc.Handle(http.MethodGet, pattern, handler)
+}
 
-	route := &Route{
-		regexp:regex,
-		params:params,
-		controllerType:t,
-	}
+// Post 注册 POST 请求的处理函数, 见 Handle
+func (rc *RegistorController) Post(pattern string, handler interface{}) *Route {
+	return rc.Handle(http.MethodPost, pattern, handler)
+}
 
-	if len(rc.routers) == 0 {
-		rc.routers = make([]*Route, 0)
-	}
+// Put 注册 PUT 请求的处理函数, 见 Handle
+func (rc *RegistorController) Put(pattern string, handler interface{}) *Route {
+	return rc.Handle(http.MethodPut, pattern, handler)
+}
 
-	rc.routers = append(rc.routers, route)
+// Delete 注册 DELETE 请求的处理函数, 见 Handle
+func (rc *RegistorController) Delete(pattern string, handler interface{}) *Route {
+	return rc.Handle(http.MethodDelete, pattern, handler)
 }
 
-var StaticDir map[string]string = map[string]string{"/public":"public"}
+// Handle 注册某个请求方法的处理函数. handler 可以是 http.Handler, http.HandlerFunc,
+// func(http.ResponseWriter, *http.Request), func(*Context), func(*Context) error, 也可以是控制器,
+// 控制器按请求方法调用同名的 Get, Post 等方法.
+func (rc *RegistorController) Handle(method, pattern string, handler interface{}) *Route {
+	method = strings.ToUpper(method)
+	return rc.addRoute(pattern, map[string]*routeHandler{method: newRouteHandler(method, pattern, handler)})
+}
 
-func (rc *RegistorController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func newRouteHandler(method, pattern string, handler interface{}) *routeHandler {
+	if !isHTTPMethod(method) {
+		panic("router: unknown http method " + method)
+	}
 
-	var isFindRouter bool
+	switch fn := handler.(type) {
+	case ControllerInterface:
+		t := reflect.Indirect(reflect.ValueOf(fn)).Type()
+		for _, m := range httpMethods {
+			if m.method == method {
+				// 没有处理方法时只会返回 405, 注册时就报错
+				if !hasHandler(t, m.name) {
+					panic("router: " + t.String() + " has no method " + m.name + "() for " + method + " " + pattern)
+				}
+				return newControllerHandler(t, nil, m.name)
+			}
+		}
+	case func(*Context) error:
+		return &routeHandler{fn: fn}
+	case func(*Context):
+		return &routeHandler{fn: func(ctx *Context) error { fn(ctx); return nil }}
+	case http.Handler:
+		return &routeHandler{fn: func(ctx *Context) error { fn.ServeHTTP(ctx.ResponseWriter, ctx.Request); return nil }}
+	case func(http.ResponseWriter, *http.Request):
+		return &routeHandler{fn: func(ctx *Context) error { fn(ctx.ResponseWriter, ctx.Request); return nil }}
+	}
 
-	for prefix, staticDir := range StaticDir {
-		if strings.HasPrefix(r.URL.Path, prefix) {
-			file := staticDir + r.URL.Path[len(prefix):]
+	panic(fmt.Sprintf("router: unsupported handler type %T for %s %s", handler, method, pattern))
+}
 
-			http.ServeFile(w, r, file)
+// addRoute 把处理者挂到 pattern 对应的路由上, 同一个 pattern 可以多次注册不同的请求方法
+func (rc *RegistorController) addRoute(pattern string, handlers map[string]*routeHandler) *Route {
+	if len(pattern) == 0 {
+		panic("register pattern can not null")
+	}
 
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
 
-			isFindRouter = true
-			return
-		}
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
 	}
 
-	requestPath := r.URL.Path
+	if rc.tree == nil {
+		rc.tree = &node{kind: staticNode}
+	}
 
+	leaf, err := rc.tree.insert(segments)
+	if err != nil {
+		panic(err)
+	}
 
+	route := leaf.route
+	if route == nil {
+		regex, regexpErr := patternRegexp(segments)
+		if regexpErr != nil {
+			panic(regexpErr)
+		}
 
-	for _, route := range rc.routers {
-		if !route.regexp.MatchString(requestPath) {
-			continue
+		params := make([]string, 0)
+		for _, seg := range segments {
+			if seg.kind != staticNode {
+				params = append(params, seg.text)
+			}
 		}
 
-		matchs := route.regexp.FindStringSubmatch(requestPath)
-		if len(matchs[0]) != len(requestPath) {
+		route = &Route{routePath: &routePath{
+			router:   rc,
+			pattern:  pattern,
+			segments: segments,
+			regexp:   regex,
+			params:   params,
+			handlers: make(map[string]*routeHandler),
+		}}
+		leaf.route = route
+		rc.routers = append(rc.routers, route)
+	} else if route.pattern != pattern {
+		panic("router: " + pattern + " conflicts with " + route.pattern)
+	}
+
+	registered := &Route{routePath: route.routePath}
+	for _, m := range httpMethods {
+		h, ok := handlers[m.method]
+		if !ok {
 			continue
 		}
+		if _, ok := route.handlers[m.method]; ok {
+			panic("router: " + m.method + " " + pattern + " is already registered")
+		}
+		route.handlers[m.method] = h
+		if !registered.has(h) {
+			registered.registered = append(registered.registered, h)
+		}
+	}
+	route.allow = allowHeader(route.handlers)
+	rc.version.Add(1)
 
-		params := make(map[string]string)
-		if len(route.params) > 0 {
-			values := r.URL.Query()
+	return registered
+}
 
-			// 路由参数
-			for i, match := range matchs[1:] {
-				values.Add(route.params[i], match)
-				params[route.params[i]] = match
-			}
+// has 判断 h 是不是这次注册的处理者, 同一个处理者可能对应多个请求方法
+func (route *Route) has(h *routeHandler) bool {
+	for _, r := range route.registered {
+		if r == h {
+			return true
+		}
+	}
+	return false
+}
 
-			// URL的整体参数是路由参数与普通参数一起
+func isHTTPMethod(method string) bool {
+	for _, m := range httpMethods {
+		if m.method == method {
+			return true
+		}
+	}
+	return false
+}
 
-			if r.URL.RawQuery != "" {
-				r.URL.RawQuery = values.Encode() + "&" + r.URL.RawQuery
-			}else {
-				r.URL.RawQuery = values.Encode()
-			}
+// allowHeader 生成 Allow 头. 实现了 GET 就能自动处理 HEAD, OPTIONS 总是由路由自动处理.
+func allowHeader(handlers map[string]*routeHandler) string {
+	allow := make([]string, 0, len(httpMethods))
+	for _, m := range httpMethods {
+		_, ok := handlers[m.method]
+		switch m.method {
+		case http.MethodHead:
+			_, get := handlers[http.MethodGet]
+			ok = ok || get
+		case http.MethodOptions:
+			ok = true
+		}
 
+		if ok {
+			allow = append(allow, m.method)
 		}
+	}
+
+	return strings.Join(allow, ", ")
+}
 
-		vc := reflect.New(route.controllerType)
+func (rc *RegistorController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 记录是否已经开始响应, 出错时据此决定还能不能渲染错误页面
+	sw := &statusWriter{ResponseWriter: w}
+	w = sw
 
-		// find method with bind router
-		init := vc.MethodByName("Init")
-		controllerCtx := &Context{ResponseWriter:w, Request:r, Params:params}
+	defer func() {
+		if v := recover(); v != nil {
+			rc.recoverPanic(w, r, v)
+		}
+	}()
 
-		in := make([]reflect.Value, 2)
-		in[0] = reflect.ValueOf(controllerCtx)
-		in[1] = reflect.ValueOf(route.controllerType.Name())
-		init.Call(in)
+	var route *Route
+	var values []string
 
-		in = make([]reflect.Value, 0)
-		method := vc.MethodByName("Prepare")
-		method.Call(in)
+	if rc.tree != nil {
+		route, values = rc.tree.lookup(r.URL.Path, nil)
+	}
 
-		if r.Method == "GET" {
-			method = vc.MethodByName("Get")
-			method.Call(in)
+	params := make(map[string]string)
+	if route != nil {
+		for i, value := range values {
+			params[route.params[i]] = value
 		}
+	}
 
-		// other case
+	// 先匹配路由再执行中间件, 中间件可以通过 FromRequest 拿到路由参数.
+	// 路由参数只放在 Context 中, 不修改请求的 URL
+	ctx := &Context{ResponseWriter: w, Params: params, router: rc, rootWriter: sw}
+	r = r.WithContext(context.WithValue(r.Context(), frameworkContextKey, ctx))
+	if rc.ParamsInQuery && len(params) > 0 {
+		r.URL = paramsInQuery(r.URL, route.params, params)
+	}
+	ctx.Request = r
 
-		method = vc.MethodByName("Render")
-		renderErr := method.Call(in)
-		if renderErr != nil {
-			fmt.Println(renderErr)
+	if route == nil {
+		rc.notFounds.get(&rc.version, "", func() http.Handler {
+			return chain(http.HandlerFunc(rc.notFound), rc.middlewares)
+		}).ServeHTTP(w, r)
+		return
+	}
 
-		}
+	method := route.chainKey(r.Method)
+	route.chains.get(&rc.version, method, func() http.Handler {
+		return chain(rc.routeHandler(route, method), rc.middlewares)
+	}).ServeHTTP(w, r)
+}
 
-		// finish
+// chainKey 返回缓存 method 请求的 handler 用的键, 没有注册的方法都返回 405, 共用一个键
+func (route *Route) chainKey(method string) string {
+	if _, ok := route.handlers[method]; ok {
+		return method
+	}
+	if method == http.MethodHead || method == http.MethodOptions {
+		return method
+	}
+	return ""
+}
 
-		isFindRouter = true
-		break
+// paramsInQuery 返回把路由参数加在 query 前面的 URL 副本, 原来的 query 一个字节都不改
+func paramsInQuery(u *url.URL, names []string, params map[string]string) *url.URL {
+	query := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		query = append(query, url.QueryEscape(name)+"="+url.QueryEscape(params[name]))
+	}
+	if u.RawQuery != "" {
+		query = append(query, u.RawQuery)
 	}
 
-	if isFindRouter == false {
-		http.NotFound(w, r)
+	u2 := *u
+	u2.RawQuery = strings.Join(query, "&")
+	return &u2
+}
+
+// routeHandler 返回路由上处理 method 请求的 handler, 由内到外依次包裹路由中间件和分组中间件.
+// 没有注册的方法返回 405, OPTIONS 请求自动返回 Allow 头, 二者都包裹路径上所有请求方法所在的分组的中间件.
+func (rc *RegistorController) routeHandler(route *Route, method string) http.Handler {
+	rh, ok := route.handlers[method]
+	if !ok && method == http.MethodHead {
+		// HEAD 交给 GET 的处理者, net/http 会丢弃 HEAD 请求的响应体
+		rh, ok = route.handlers[http.MethodGet]
 	}
+
+	var h http.Handler
+	switch {
+	case ok:
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc.dispatch(rh, w, r)
+		})
+	case method == http.MethodOptions:
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", route.allow)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	default:
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", route.allow)
+			rc.HandleError(w, r, NewHTTPError(http.StatusMethodNotAllowed, ""))
+		})
+	}
+
+	if ok {
+		h = rh.group.wrap(chain(h, rh.middlewares))
+	} else {
+		// 自动生成的 OPTIONS 和 405 也要经过分组中间件, 分组的 CORS 才能响应预检请求, 认证也不会被绕过
+		h = wrapGroups(h, route.handlers)
+	}
+
+	return h
 }
 
+// dispatch 把请求交给处理者, 控制器按 Init, Prepare, 处理方法, Render 的顺序执行
+func (rc *RegistorController) dispatch(h *routeHandler, w http.ResponseWriter, r *http.Request) {
+	// 中间件可能替换了 ResponseWriter 和 Request
+	controllerCtx := FromRequest(r)
+	controllerCtx.ResponseWriter = w
+	controllerCtx.Request = r
+
+	if h.fn != nil {
+		err := h.fn(controllerCtx)
+		if err == nil {
+			err = controllerCtx.err
+		}
+		if err != nil {
+			rc.HandleError(w, r, err)
+		}
+		return
+	}
+
+	if err := runController(h, controllerCtx); err != nil {
+		rc.HandleError(w, r, err)
+	}
+}
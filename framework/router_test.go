@@ -0,0 +1,243 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type getController struct {
+	Controller
+}
+
+func (c *getController) Get() {
+	c.Ctx.ResponseWriter.Write([]byte("get"))
+}
+
+type postController struct {
+	getController
+}
+
+func (c *postController) Post() {
+	c.Ctx.ResponseWriter.Write([]byte("post"))
+}
+
+func (c postController) Delete() {
+	c.Ctx.ResponseWriter.Write([]byte("delete"))
+}
+
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+// nestedController 嵌入两层, Get 从 getController 继承, Post 和 Delete 从 postController 继承
+type nestedController struct {
+	postController
+}
+
+func (c *nestedController) Patch() {
+	c.Ctx.ResponseWriter.Write([]byte("patch"))
+}
+
+func TestMethodDispatch(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Add("/get", &getController{})
+	rc.Add("/post", &postController{})
+	rc.Add("/nested", &nestedController{})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+		allow  string
+	}{
+		{"GET", "/get", 200, "get", ""},
+		{"POST", "/get", 405, "Method Not Allowed\n", "GET, HEAD, OPTIONS"},
+		{"PUT", "/get", 405, "Method Not Allowed\n", "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/get", 204, "", "GET, HEAD, OPTIONS"},
+		{"HEAD", "/get", 200, "get", ""},
+		{"GET", "/post", 200, "get", ""},
+		{"POST", "/post", 200, "post", ""},
+		{"DELETE", "/post", 200, "delete", ""},
+		{"PATCH", "/post", 405, "Method Not Allowed\n", "GET, HEAD, POST, DELETE, OPTIONS"},
+		{"GET", "/nested", 200, "get", ""},
+		{"POST", "/nested", 200, "post", ""},
+		{"PATCH", "/nested", 200, "patch", ""},
+		{"PUT", "/nested", 405, "Method Not Allowed\n", "GET, HEAD, POST, PATCH, DELETE, OPTIONS"},
+	}
+	for i, v := range tests {
+		w := serve(rc, v.method, v.path)
+		if w.Code != v.code {
+			t.Fatalf("%v: bad status: got %v, want %v", i+1, w.Code, v.code)
+		}
+		if w.Body.String() != v.body {
+			t.Fatalf("%v: bad body: got %q, want %q", i+1, w.Body.String(), v.body)
+		}
+		if allow := w.Header().Get("Allow"); allow != v.allow {
+			t.Fatalf("%v: bad Allow header: got %q, want %q", i+1, allow, v.allow)
+		}
+	}
+}
+
+type postsController struct {
+	Controller
+}
+
+func (c *postsController) List() {
+	c.Ctx.ResponseWriter.Write([]byte("list"))
+}
+
+func (c *postsController) Create() {
+	c.Ctx.ResponseWriter.Write([]byte("create"))
+}
+
+func TestMethodMapping(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Add("/posts", &postsController{}, "get:List;post:Create")
+	rc.Put("/posts", func(ctx *Context) {
+		ctx.ResponseWriter.Write([]byte("put " + ctx.Request.URL.Path))
+	})
+	rc.Delete("/posts/:id", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("delete"))
+	}))
+	rc.Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	rc.Post("/hello", &postController{})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/posts", 200, "list"},
+		{"POST", "/posts", 200, "create"},
+		{"PUT", "/posts", 200, "put /posts"},
+		{"PATCH", "/posts", 405, "Method Not Allowed\n"},
+		{"DELETE", "/posts/1", 200, "delete"},
+		{"GET", "/hello", 200, "hello"},
+		{"POST", "/hello", 200, "post"},
+	}
+	for i, v := range tests {
+		w := serve(rc, v.method, v.path)
+		if w.Code != v.code {
+			t.Fatalf("%v: bad status: got %v, want %v", i+1, w.Code, v.code)
+		}
+		if w.Body.String() != v.body {
+			t.Fatalf("%v: bad body: got %q, want %q", i+1, w.Body.String(), v.body)
+		}
+	}
+
+	if allow := serve(rc, "OPTIONS", "/posts").Header().Get("Allow"); allow != "GET, HEAD, POST, PUT, OPTIONS" {
+		t.Fatalf("bad Allow header: got %q", allow)
+	}
+}
+
+func TestMethodMappingError(t *testing.T) {
+	mappings := []string{"get:Missing", "get", "fetch:List", "get:Init"}
+	for _, mapping := range mappings {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("mapping %q: expected a registration panic", mapping)
+				}
+			}()
+			rc := &RegistorController{}
+			rc.Add("/posts", &postsController{}, mapping)
+		}()
+	}
+
+	// 控制器没有这个请求方法的处理方法
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic for a method the controller does not override")
+			}
+		}()
+		rc := &RegistorController{}
+		rc.Put("/get", &getController{})
+	}()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a duplicate registration panic")
+		}
+	}()
+	rc := &RegistorController{}
+	rc.Add("/posts", &postsController{}, "get:List")
+	rc.Get("/posts", func(*Context) {})
+}
+
+func TestQueryRoundTrip(t *testing.T) {
+	queries := []string{
+		"",
+		"b=2&a=1",
+		"a=1&a=2",
+		"id=7",
+		"x=%2F%20+y&z=%E4%BD%A0",
+		"sig=abc%3D%3D&exp=1700000000",
+		"flag",
+		"a=1;b=2",
+		"%zz=bad",
+	}
+
+	for _, compat := range []bool{false, true} {
+		var middlewareQuery, handlerQuery string
+		var params map[string]string
+
+		rc := &RegistorController{ParamsInQuery: compat}
+		rc.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				middlewareQuery = r.URL.RawQuery
+				next.ServeHTTP(w, r)
+			})
+		})
+		rc.Get("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+			handlerQuery = r.URL.RawQuery
+			params = RouteParams(r)
+		})
+
+		for i, query := range queries {
+			target := "/users/42"
+			if query != "" {
+				target += "?" + query
+			}
+			r := httptest.NewRequest("GET", target, nil)
+			rc.ServeHTTP(httptest.NewRecorder(), r)
+
+			want := query
+			if compat {
+				want = "id=42"
+				if query != "" {
+					want += "&" + query
+				}
+			}
+
+			if middlewareQuery != want || handlerQuery != want {
+				t.Fatalf("%v: compat %v: bad query: got %q and %q, want %q", i+1, compat, middlewareQuery, handlerQuery, want)
+			}
+			if r.URL.RawQuery != query {
+				t.Fatalf("%v: compat %v: request modified: got %q, want %q", i+1, compat, r.URL.RawQuery, query)
+			}
+			if params["id"] != "42" {
+				t.Fatalf("%v: compat %v: bad params: got %v", i+1, compat, params)
+			}
+		}
+	}
+}
+
+func TestParamsInQueryPriority(t *testing.T) {
+	rc := &RegistorController{ParamsInQuery: true}
+	rc.Get("/users/:id", func(ctx *Context) {
+		ctx.ResponseWriter.Write([]byte(ctx.Request.URL.Query().Get("id") + " " + ctx.Query("id")))
+	})
+
+	w := serve(rc, "GET", "/users/a%20b?id=7")
+	if got, want := w.Body.String(), "a b a b"; got != want {
+		t.Fatalf("bad body: got %q, want %q", got, want)
+	}
+}
@@ -24,6 +24,9 @@ type SessionMgr struct {
 	mMaxLifeTime int64
 
 	mSessions map[string]*Session
+
+	mGcTimer *time.Timer // 下一次 Gc 的定时器, Stop 之后为 nil
+	mStopped bool
 }
 
 func NewSessionMgr(cookieName string, maxLeftTime int64) *SessionMgr {
@@ -49,7 +52,9 @@ func (mgr *SessionMgr) StartSession(w http.ResponseWriter, r *http.Request) stri
 		mValues: map[interface{}]interface{}{},
 	}
 
+	mgr.mLock.Lock()
 	mgr.mSessions[newSessionID] = session
+	mgr.mLock.Unlock()
 
 	cookie := &http.Cookie{
 		Name:mgr.mCookieName,
@@ -133,13 +138,29 @@ func (mgr *SessionMgr) Gc() {
 	mgr.mLock.Lock()
 	defer mgr.mLock.Unlock()
 
+	if mgr.mStopped {
+		return
+	}
+
 	for sessionId, session := range mgr.mSessions {
 		if session.mLastTimeAccessed.Unix() + mgr.mMaxLifeTime < time.Now().Unix() {
 			delete(mgr.mSessions, sessionId)
 		}
 	}
 
-	time.AfterFunc(time.Duration(mgr.mMaxLifeTime) * time.Second, mgr.Gc)
+	mgr.mGcTimer = time.AfterFunc(time.Duration(mgr.mMaxLifeTime) * time.Second, mgr.Gc)
+}
+
+// Stop 停止定时 Gc, 之后不会再清理过期的会话
+func (mgr *SessionMgr) Stop() {
+	mgr.mLock.Lock()
+	defer mgr.mLock.Unlock()
+
+	mgr.mStopped = true
+	if mgr.mGcTimer != nil {
+		mgr.mGcTimer.Stop()
+		mgr.mGcTimer = nil
+	}
 }
 
 
@@ -0,0 +1,260 @@
+// 静态文件
+// Static 把 prefix 下的请求映射到目录中的文件, 注册为 prefix/*filepath 的 GET 路由
+// (prefix 本身跳转到 prefix/), 和其他路由一样按最长匹配选择, 也会经过全局中间件. 文件不存在时按 404 渲染错误页面.
+//
+//	rc.Static("/public", "public", StaticOptions{MaxAge: time.Hour})
+//	rc.StaticFS("/assets", assetsFS, StaticOptions{Precompressed: true}) // embed.FS
+package framework
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StaticOptions 静态文件配置, 零值即默认配置
+type StaticOptions struct {
+	// Browse 允许列出没有 index.html 的目录, 默认不允许, 返回 404
+	Browse bool
+	// MaxAge 浏览器缓存时间, 设置了就发送 Cache-Control: public, max-age=N,
+	// 否则发送 no-cache, 浏览器每次用 ETag 和 Last-Modified 确认文件是否变化
+	MaxAge time.Duration
+	// Immutable 在 Cache-Control 中加上 immutable, 用于文件名带内容哈希的文件
+	Immutable bool
+	// Precompressed 客户端支持时优先返回预先压缩好的 .br, .gz 文件
+	Precompressed bool
+	// ShowHidden 允许访问以 . 开头的文件和目录, 默认不允许, 避免泄露 .git, .env 之类的文件
+	ShowHidden bool
+	// Manifest 静态文件清单, 设置之后也可以用清单中带哈希的文件名访问, 这些文件缓存一年, 见 AssetManifest
+	Manifest *AssetManifest
+}
+
+// Static 用本地目录 dir 提供 prefix 下的静态文件, 请求的路径不能跳出 dir. 访问 prefix 本身时跳转到 prefix/
+func (rc *RegistorController) Static(prefix, dir string, opts StaticOptions) *Route {
+	return rc.StaticFS(prefix, os.DirFS(dir), opts)
+}
+
+// StaticFS 同 Static, 文件来自 fsys, 例如 embed.FS
+func (rc *RegistorController) StaticFS(prefix string, fsys fs.FS, opts StaticOptions) *Route {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if opts.Manifest != nil && opts.Manifest.Prefix != prefix {
+		panic("router: asset manifest prefix " + opts.Manifest.Prefix + " does not match static prefix " + prefix)
+	}
+	if prefix != "" {
+		// 不带 / 的前缀跳转到根目录, 和访问子目录一样
+		rc.Get(prefix, func(w http.ResponseWriter, r *http.Request) {
+			target := path.Base(r.URL.Path) + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		})
+	}
+	return rc.Get(prefix+"/*filepath", (&staticHandler{fsys: fsys, opts: opts}).serve)
+}
+
+type staticHandler struct {
+	fsys fs.FS
+	opts StaticOptions
+
+	etags sync.Map // 没有修改时间的文件 (embed.FS) 按内容计算的 ETag, name: etag
+}
+
+// staticEncodings 是预压缩文件的编码和扩展名, 按优先级排列
+var staticEncodings = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func (s *staticHandler) serve(ctx *Context) error {
+	w, r := ctx.ResponseWriter, ctx.Request
+
+	// fs.FS 的路径不能以 / 开头, 也不能含有 .., Clean 之后再去掉开头的 /
+	name := path.Clean("/" + ctx.Param("filepath"))[1:]
+	if name == "" {
+		name = "."
+	}
+	if strings.ContainsAny(name, "\\\x00") || (!s.opts.ShowHidden && hasHiddenSegment(name)) {
+		return fs.ErrNotExist
+	}
+
+	// 带哈希的文件名映射回原文件, 内容变了文件名就会变, 可以永久缓存
+	fingerprinted := false
+	if s.opts.Manifest != nil {
+		if original, ok := s.opts.Manifest.original(name); ok {
+			name, fingerprinted = original, true
+		}
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return notExist(err)
+	}
+
+	if info.IsDir() {
+		index := path.Join(name, "index.html")
+		indexInfo, err := fs.Stat(s.fsys, index)
+		hasIndex := err == nil && !indexInfo.IsDir()
+		if !hasIndex && !s.opts.Browse {
+			return fs.ErrNotExist
+		}
+
+		// 目录以 / 结尾, 页面中的相对链接才正确
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := path.Base(r.URL.Path) + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return nil
+		}
+
+		if !hasIndex {
+			return s.list(w, name)
+		}
+		name, info = index, indexInfo
+	}
+
+	h := w.Header()
+	if fingerprinted {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else if s.opts.MaxAge > 0 {
+		cc := "public, max-age=" + strconv.Itoa(int(s.opts.MaxAge/time.Second))
+		if s.opts.Immutable {
+			cc += ", immutable"
+		}
+		h.Set("Cache-Control", cc)
+	} else {
+		h.Set("Cache-Control", "no-cache")
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+
+	if s.opts.Precompressed {
+		h.Add("Vary", "Accept-Encoding")
+		for _, enc := range staticEncodings {
+			if !acceptsEncoding(r, enc.encoding) {
+				continue
+			}
+			if encInfo, err := fs.Stat(s.fsys, name+enc.ext); err == nil && !encInfo.IsDir() {
+				h.Set("Content-Encoding", enc.encoding)
+				name, info = name+enc.ext, encInfo
+				break
+			}
+		}
+	}
+
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return notExist(err)
+	}
+	defer f.Close()
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+
+	etag, err := s.etag(name, info, content)
+	if err != nil {
+		return err
+	}
+	h.Set("ETag", etag)
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+	return nil
+}
+
+// etag 用文件大小和修改时间生成 ETag, 没有修改时间的文件 (embed.FS) 用内容的哈希, 算一次之后缓存
+func (s *staticHandler) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()), nil
+	}
+
+	if etag, ok := s.etags.Load(name); ok {
+		return etag.(string), nil
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	s.etags.Store(name, etag)
+	return etag, nil
+}
+
+var dirListTemplate = template.Must(template.New("dir").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>{{.Name}}</title></head>
+<body>
+<pre>
+{{range .Entries}}<a href="{{.Href}}">{{.Name}}</a>
+{{end}}</pre>
+</body>
+</html>
+`))
+
+// list 列出目录 name 中的文件, 子目录以 / 结尾
+func (s *staticHandler) list(w http.ResponseWriter, name string) error {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return notExist(err)
+	}
+
+	type entry struct{ Name, Href string }
+	list := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		if !s.opts.ShowHidden && strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		// 文件名中的 ? # : 之类的字符要转义, 否则会被当成 query 或者协议
+		list = append(list, entry{Name: name, Href: (&url.URL{Path: name}).String()})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	return dirListTemplate.Execute(w, map[string]interface{}{"Name": "/" + strings.TrimPrefix(name, "."), "Entries": list})
+}
+
+func hasHiddenSegment(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// notExist 把打开文件的错误都当成 404, 不向客户端暴露没有权限之类的细节, 原始错误只在开发模式下展示
+func notExist(err error) error {
+	return &HTTPError{Code: http.StatusNotFound, Err: err}
+}
@@ -0,0 +1,136 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStatic(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.css":           "body{}",
+		"app.css.gz":        "gzipped",
+		"app.css.br":        "brotli",
+		"docs/index.html":   "docs",
+		"img/a.txt":         "a",
+		".env":              "secret",
+		".git/config":       "secret",
+		"../outside.txt":    "outside",
+		"publicfoo/foo.txt": "foo",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, "public", name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		os.WriteFile(file, []byte(content), 0644)
+	}
+
+	rc := &RegistorController{}
+	rc.Static("/public", filepath.Join(dir, "public"), StaticOptions{MaxAge: time.Hour, Precompressed: true})
+	rc.Static("/public/img", filepath.Join(dir, "public", "docs"), StaticOptions{})
+	rc.Static("/browse/", filepath.Join(dir, "public"), StaticOptions{Browse: true})
+
+	tests := []struct {
+		path     string
+		encoding string
+		code     int
+		body     string
+		headers  map[string]string
+	}{
+		{"/public/app.css", "", 200, "body{}", map[string]string{"Content-Type": "text/css; charset=utf-8", "Cache-Control": "public, max-age=3600", "Content-Encoding": "", "Vary": "Accept-Encoding"}},
+		{"/public/app.css", "gzip", 200, "gzipped", map[string]string{"Content-Type": "text/css; charset=utf-8", "Content-Encoding": "gzip"}},
+		{"/public/app.css", "gzip, br", 200, "brotli", map[string]string{"Content-Encoding": "br"}},
+		{"/public/docs/", "", 200, "docs", nil},
+		{"/public/docs", "", 301, "", map[string]string{"Location": "/public/docs/"}},
+		{"/public/img/", "", 200, "docs", map[string]string{"Cache-Control": "no-cache"}},
+		{"/public/img/a.txt", "", 404, "", nil},
+		{"/public/", "", 404, "", nil},
+		{"/public", "", 301, "", map[string]string{"Location": "/public/"}},
+		{"/public/img", "", 301, "", map[string]string{"Location": "/public/img/"}},
+		{"/browse", "", 301, "", map[string]string{"Location": "/browse/"}},
+		{"/public/.env", "", 404, "", nil},
+		{"/public/.git/config", "", 404, "", nil},
+		{"/public/../outside.txt", "", 404, "", nil},
+		{"/public/%2e%2e/outside.txt", "", 404, "", nil},
+		{"/public/..%2foutside.txt", "", 404, "", nil},
+		{"/public/missing.css", "", 404, "", nil},
+		{"/publicfoo/foo.txt", "", 404, "", nil},
+		{"/browse/img/a.txt", "", 200, "a", nil},
+	}
+
+	for i, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL.Path = tt.path
+		if tt.encoding != "" {
+			r.Header.Set("Accept-Encoding", tt.encoding)
+		}
+		w := httptest.NewRecorder()
+		rc.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Fatalf("%v: %s: bad code: got %d, want %d", i+1, tt.path, w.Code, tt.code)
+		}
+		if tt.code == 200 && w.Body.String() != tt.body {
+			t.Fatalf("%v: %s: bad body: got %q, want %q", i+1, tt.path, w.Body.String(), tt.body)
+		}
+		for key, want := range tt.headers {
+			if got := w.Header().Get(key); got != want {
+				t.Fatalf("%v: %s: bad %s: got %q, want %q", i+1, tt.path, key, got, want)
+			}
+		}
+	}
+
+	w := serve(rc, "GET", "/browse/")
+	body := w.Body.String()
+	if w.Code != 200 || !strings.Contains(body, `<a href="app.css">app.css</a>`) || !strings.Contains(body, `<a href="img/">img/</a>`) || strings.Contains(body, ".env") {
+		t.Fatalf("bad listing: got %d %q", w.Code, body)
+	}
+}
+
+func TestStaticConditional(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":     {Data: []byte("console.log(1)")},
+		"old.js":     {Data: []byte("old"), ModTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"dir/x.html": {Data: []byte("x")},
+	}
+
+	rc := &RegistorController{}
+	rc.StaticFS("/assets", fsys, StaticOptions{MaxAge: 365 * 24 * time.Hour, Immutable: true})
+
+	w := serve(rc, "GET", "/assets/app.js")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || w.Header().Get("Last-Modified") != "" {
+		t.Fatalf("bad response: got %d, etag %q, last modified %q", w.Code, etag, w.Header().Get("Last-Modified"))
+	}
+	if got, want := w.Header().Get("Cache-Control"), "public, max-age=31536000, immutable"; got != want {
+		t.Fatalf("bad cache control: got %q, want %q", got, want)
+	}
+
+	r := httptest.NewRequest("GET", "/assets/app.js", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("bad code: got %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	r = httptest.NewRequest("GET", "/assets/old.js", nil)
+	r.Header.Set("If-Modified-Since", "Wed, 01 Jan 2020 00:00:00 GMT")
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("bad code: got %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	if w := serve(rc, "GET", "/assets/dir/"); w.Code != http.StatusNotFound {
+		t.Fatalf("bad code: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serve(rc, "HEAD", "/assets/app.js"); w.Code != http.StatusOK {
+		t.Fatalf("bad code: got %d, want %d", w.Code, http.StatusOK)
+	}
+}
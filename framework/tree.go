@@ -0,0 +1,265 @@
+// 路由前缀树(radix tree)
+// 静态部分按公共前缀压缩, 参数和通配符作为单独的子节点,
+// 匹配优先级: 静态 > 参数 > 通配符, 与注册顺序无关.
+package framework
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type nodeKind uint8
+
+const (
+	staticNode   nodeKind = iota // /users
+	paramNode                    // :id, :id([0-9]+)
+	catchAllNode                 // *filepath
+)
+
+type node struct {
+	kind   nodeKind
+	prefix string         // 静态节点: 压缩后的路径片段; 参数和通配符节点: 参数名
+	expr   string         // 参数约束的原始正则, 用于判断是否是同一个参数
+	regexp *regexp.Regexp // 参数约束, 需要匹配整个路径段
+
+	children []*node // 静态子节点, 首字节互不相同
+	params   []*node // 参数子节点, 有约束的排在前面
+	catchAll *node
+
+	route *Route
+}
+
+// segment 是解析后的路由片段
+type segment struct {
+	kind nodeKind
+	text string // 静态文本或参数名
+	expr string // 参数约束
+}
+
+// parsePattern 把 /users/:id([0-9]+)/*rest 这样的路由拆成静态片段和参数片段.
+// 参数和通配符必须占据一整个路径段, 通配符只能出现在最后.
+func parsePattern(pattern string) ([]segment, error) {
+	parts := strings.Split(pattern, "/")
+	segments := make([]segment, 0, len(parts))
+	static := ""
+
+	for i, part := range parts {
+		if i > 0 {
+			static += "/"
+		}
+
+		switch {
+		case strings.HasPrefix(part, ":"):
+			name, expr := part[1:], ""
+			if index := strings.Index(part, "("); index != -1 {
+				if !strings.HasSuffix(part, ")") {
+					return nil, fmt.Errorf("router: unclosed constraint in %q", part)
+				}
+				name, expr = part[1:index], part[index+1:len(part)-1]
+			}
+			if name == "" {
+				return nil, fmt.Errorf("router: empty param name in %q", pattern)
+			}
+
+			if static != "" {
+				segments = append(segments, segment{kind: staticNode, text: static})
+				static = ""
+			}
+			segments = append(segments, segment{kind: paramNode, text: name, expr: expr})
+
+		case strings.HasPrefix(part, "*"):
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("router: catch-all must be the last segment in %q", pattern)
+			}
+			if part == "*" {
+				return nil, fmt.Errorf("router: empty catch-all name in %q", pattern)
+			}
+
+			if static != "" {
+				segments = append(segments, segment{kind: staticNode, text: static})
+				static = ""
+			}
+			segments = append(segments, segment{kind: catchAllNode, text: part[1:]})
+
+		default:
+			static += part
+		}
+	}
+
+	if static != "" {
+		segments = append(segments, segment{kind: staticNode, text: static})
+	}
+
+	return segments, nil
+}
+
+// patternRegexp 把解析后的路由还原成一个完整的正则, 参数按顺序成为子匹配
+func patternRegexp(segments []segment) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, seg := range segments {
+		switch seg.kind {
+		case staticNode:
+			expr.WriteString(regexp.QuoteMeta(seg.text))
+		case paramNode:
+			if seg.expr == "" {
+				expr.WriteString("([^/]+)")
+			} else {
+				expr.WriteString("((?:" + seg.expr + "))")
+			}
+		case catchAllNode:
+			expr.WriteString("(.*)")
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+// insert 把路由挂到树上, 返回叶子节点
+func (n *node) insert(segments []segment) (*node, error) {
+	for _, seg := range segments {
+		var err error
+		switch seg.kind {
+		case staticNode:
+			n = n.insertStatic(seg.text)
+		case paramNode:
+			n, err = n.insertParam(seg.text, seg.expr)
+		case catchAllNode:
+			n, err = n.insertCatchAll(seg.text)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+func (n *node) insertStatic(path string) *node {
+	for path != "" {
+		var child *node
+		for _, c := range n.children {
+			if c.prefix[0] == path[0] {
+				child = c
+				break
+			}
+		}
+
+		if child == nil {
+			child = &node{kind: staticNode, prefix: path}
+			n.children = append(n.children, child)
+			return child
+		}
+
+		l := commonPrefix(child.prefix, path)
+		if l < len(child.prefix) {
+			// 分裂节点: child 的前缀只保留公共部分, 剩下的部分下沉成新的子节点
+			rest := *child
+			rest.prefix = child.prefix[l:]
+			*child = node{kind: staticNode, prefix: child.prefix[:l], children: []*node{&rest}}
+		}
+
+		n = child
+		path = path[l:]
+	}
+
+	return n
+}
+
+func (n *node) insertParam(name, expr string) (*node, error) {
+	for _, p := range n.params {
+		if p.prefix == name && p.expr == expr {
+			return p, nil
+		}
+	}
+
+	child := &node{kind: paramNode, prefix: name, expr: expr}
+	if expr != "" {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, err
+		}
+		child.regexp = re
+	}
+
+	// 有约束的参数优先于无约束的参数, 同类之间按注册顺序
+	i := len(n.params)
+	if expr != "" {
+		i = 0
+		for i < len(n.params) && n.params[i].regexp != nil {
+			i++
+		}
+	}
+	n.params = append(n.params, nil)
+	copy(n.params[i+1:], n.params[i:])
+	n.params[i] = child
+
+	return child, nil
+}
+
+func (n *node) insertCatchAll(name string) (*node, error) {
+	if n.catchAll != nil {
+		if n.catchAll.prefix != name {
+			return nil, fmt.Errorf("router: catch-all *%s conflicts with *%s", name, n.catchAll.prefix)
+		}
+		return n.catchAll, nil
+	}
+
+	n.catchAll = &node{kind: catchAllNode, prefix: name}
+	return n.catchAll, nil
+}
+
+// lookup 查找 path 对应的路由, 参数值按出现顺序追加到 values.
+// 当前分支匹配失败时回溯, 依次尝试参数和通配符.
+func (n *node) lookup(path string, values []string) (*Route, []string) {
+	if path == "" && n.route != nil {
+		return n.route, values
+	}
+
+	if path != "" {
+		for _, c := range n.children {
+			if c.prefix[0] != path[0] {
+				continue
+			}
+			if strings.HasPrefix(path, c.prefix) {
+				if route, v := c.lookup(path[len(c.prefix):], values); route != nil {
+					return route, v
+				}
+			}
+			break
+		}
+
+		end := strings.IndexByte(path, '/')
+		if end == -1 {
+			end = len(path)
+		}
+		if end > 0 {
+			value := path[:end]
+			for _, p := range n.params {
+				if p.regexp != nil && !p.regexp.MatchString(value) {
+					continue
+				}
+				if route, v := p.lookup(path[end:], append(values, value)); route != nil {
+					return route, v
+				}
+			}
+		}
+	}
+
+	if n.catchAll != nil && n.catchAll.route != nil {
+		return n.catchAll.route, append(values, path)
+	}
+
+	return nil, values
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
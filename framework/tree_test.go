@@ -0,0 +1,144 @@
+package framework
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newTestTree(t testing.TB, patterns ...string) *node {
+	root := &node{kind: staticNode}
+	for _, pattern := range patterns {
+		segments, err := parsePattern(pattern)
+		if err != nil {
+			t.Fatal("parse pattern fail: ", err)
+		}
+		leaf, err := root.insert(segments)
+		if err != nil {
+			t.Fatal("insert pattern fail: ", err)
+		}
+		leaf.route = &Route{routePath: &routePath{pattern: pattern}}
+	}
+	return root
+}
+
+func TestTreeLookup(t *testing.T) {
+	root := newTestTree(t,
+		"/",
+		"/users",
+		"/users/new",
+		"/users/:id([0-9]+)",
+		"/users/:name",
+		"/users/:id([0-9]+)/:xxx(\\w+)",
+		"/users/:name/posts",
+		"/static/*filepath",
+		"/search",
+		"/se/:q",
+	)
+
+	tests := []struct {
+		path    string
+		pattern string
+		values  string
+	}{
+		{"/", "/", ""},
+		{"/users", "/users", ""},
+		{"/users/new", "/users/new", ""},
+		{"/users/42", "/users/:id([0-9]+)", "42"},
+		{"/users/hyl", "/users/:name", "hyl"},
+		{"/users/42/abc", "/users/:id([0-9]+)/:xxx(\\w+)", "42,abc"},
+		{"/users/42/posts", "/users/:id([0-9]+)/:xxx(\\w+)", "42,posts"},
+		{"/users/hyl/posts", "/users/:name/posts", "hyl"},
+		{"/users/42/a-b", "", ""},
+		{"/static/css/app.css", "/static/*filepath", "css/app.css"},
+		{"/static/", "/static/*filepath", ""},
+		{"/search", "/search", ""},
+		{"/se/go", "/se/:q", "go"},
+		{"/sea", "", ""},
+		{"/users/", "", ""},
+		{"/nothing", "", ""},
+	}
+	for i, v := range tests {
+		route, values := root.lookup(v.path, nil)
+		pattern := ""
+		if route != nil {
+			pattern = route.pattern
+		}
+		if pattern != v.pattern {
+			t.Fatalf("%v: bad route for %q: got %q, want %q", i+1, v.path, pattern, v.pattern)
+		}
+		if route != nil && strings.Join(values, ",") != v.values {
+			t.Fatalf("%v: bad params for %q: got %q, want %q", i+1, v.path, values, v.values)
+		}
+	}
+}
+
+func TestTreeInsertError(t *testing.T) {
+	for _, pattern := range []string{"/files/*/x", "/files/*", "/users/:", "/users/:id([0-9]+"} {
+		if _, err := parsePattern(pattern); err == nil {
+			t.Fatalf("parse %q: expected an error", pattern)
+		}
+	}
+
+	root := newTestTree(t, "/files/*filepath")
+	segments, _ := parsePattern("/files/*name")
+	if _, err := root.insert(segments); err == nil {
+		t.Fatal("expected catch-all conflict error")
+	}
+}
+
+// benchRoutes 生成 1000 条路由, 一半静态一半带参数
+func benchRoutes() []string {
+	patterns := make([]string, 0, 1000)
+	for i := 0; i < 500; i++ {
+		patterns = append(patterns, fmt.Sprintf("/api/v1/resource%d/list", i))
+		patterns = append(patterns, fmt.Sprintf("/api/v1/resource%d/:id([0-9]+)/:action", i))
+	}
+	return patterns
+}
+
+func BenchmarkTreeLookup1000(b *testing.B) {
+	root := newTestTree(b, benchRoutes()...)
+	paths := []string{"/api/v1/resource0/list", "/api/v1/resource499/42/edit", "/api/v1/resource250/list"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	values := make([]string, 0, 4)
+	for i := 0; i < b.N; i++ {
+		if route, _ := root.lookup(paths[i%len(paths)], values[:0]); route == nil {
+			b.Fatal("route not found")
+		}
+	}
+}
+
+// BenchmarkRegexpLookup1000 是原来逐条正则匹配的实现, 作为对比
+func BenchmarkRegexpLookup1000(b *testing.B) {
+	var routes []*regexp.Regexp
+	for _, pattern := range benchRoutes() {
+		segments, _ := parsePattern(pattern)
+		re, err := patternRegexp(segments)
+		if err != nil {
+			b.Fatal(err)
+		}
+		routes = append(routes, re)
+	}
+	paths := []string{"/api/v1/resource0/list", "/api/v1/resource499/42/edit", "/api/v1/resource250/list"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		path := paths[i%len(paths)]
+		found := false
+		for _, re := range routes {
+			if re.MatchString(path) {
+				re.FindStringSubmatch(path)
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.Fatal("route not found")
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// 文件上传
+// Upload 检查上传文件的大小和类型, 生成随机文件名之后交给 UploadStore 保存:
+//
+//	rc.Static("/public", "public", StaticOptions{})
+//	store := NewLocalStore("public/uploads", "/public/uploads")
+//	url, err := c.Upload("cover", store, UploadOptions{MaxSize: 5 << 20})
+//
+// 文件类型按内容判断, 不相信客户端给的 Content-Type 和扩展名.
+package framework
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultMaxUploadSize 是 UploadOptions.MaxSize 的默认值
+const DefaultMaxUploadSize = 10 << 20
+
+// DefaultUploadTypes 是 UploadOptions.AllowedTypes 的默认值, 只允许常见的图片
+var DefaultUploadTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// uploadExts 是类型对应的扩展名, 不在这里的类型使用 mime 包查到的第一个扩展名
+var uploadExts = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+}
+
+// UploadOptions 上传限制, 零值字段使用默认值
+type UploadOptions struct {
+	MaxSize      int64    // 文件的最大字节数, 默认 DefaultMaxUploadSize
+	AllowedTypes []string // 允许的 MIME 类型, 默认 DefaultUploadTypes
+}
+
+func (opts UploadOptions) maxSize() int64 {
+	if opts.MaxSize <= 0 {
+		return DefaultMaxUploadSize
+	}
+	return opts.MaxSize
+}
+
+// UploadStore 保存上传的文件
+type UploadStore interface {
+	// Save 以 name 保存 r 的内容, 返回可以访问这个文件的 URL. name 是 / 分隔的相对路径.
+	Save(name string, r io.Reader) (string, error)
+	// Delete 删除 Save 保存的文件
+	Delete(name string) error
+}
+
+// uploadFormOverhead 是 Upload 限制请求体大小时在文件大小之外留给其他表单字段和 multipart 边界的字节数
+const uploadFormOverhead = 1 << 20
+
+// FormFile 返回上传的文件 name, 没有这个文件时返回 400 错误, 请求体超过 RegistorController.MaxBodySize 时返回 413 错误
+func (ctx *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	r := ctx.Request
+	if r.MultipartForm == nil {
+		ctx.limitBody(ctx.maxBodySize())
+		if err := r.ParseMultipartForm(MaxMultipartMemory); err != nil {
+			return nil, bodyError(err, "invalid multipart form")
+		}
+	}
+
+	files := r.MultipartForm.File[name]
+	if len(files) == 0 {
+		return nil, &HTTPError{Code: http.StatusBadRequest, Message: "missing file " + name, Err: http.ErrMissingFile}
+	}
+	return files[0], nil
+}
+
+// SaveToFile 把上传的文件 name 保存到 dest, dest 所在的目录不存在时自动创建.
+// 不做任何检查, dest 不能来自用户输入, 保存用户上传的文件应当使用 Upload.
+func (ctx *Context) SaveToFile(name, dest string) error {
+	fh, err := ctx.FormFile(name)
+	if err != nil {
+		return err
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Upload 检查上传的文件 name 并保存到 store, 返回文件的 URL.
+// 文件太大时返回 413 错误, 类型不允许时返回 415 错误. 还没有解析表单时按 opts.MaxSize 限制请求体,
+// 太大的请求不会整个写到临时文件里.
+func (ctx *Context) Upload(name string, store UploadStore, opts UploadOptions) (string, error) {
+	if ctx.Request.MultipartForm == nil {
+		ctx.limitBody(opts.maxSize() + uploadFormOverhead)
+	}
+	fh, err := ctx.FormFile(name)
+	if err != nil {
+		return "", err
+	}
+	return Upload(fh, store, opts)
+}
+
+// FormFile 同 Context.FormFile
+func (c *Controller) FormFile(name string) (*multipart.FileHeader, error) {
+	return c.Ctx.FormFile(name)
+}
+
+// SaveToFile 同 Context.SaveToFile
+func (c *Controller) SaveToFile(name, dest string) error {
+	return c.Ctx.SaveToFile(name, dest)
+}
+
+// Upload 同 Context.Upload
+func (c *Controller) Upload(name string, store UploadStore, opts UploadOptions) (string, error) {
+	return c.Ctx.Upload(name, store, opts)
+}
+
+// Upload 检查文件 fh 并以随机文件名保存到 store, 文件名形如 2006/01/<32 位十六进制>.jpg,
+// 扩展名由文件内容决定.
+func Upload(fh *multipart.FileHeader, store UploadStore, opts UploadOptions) (string, error) {
+	opts.MaxSize = opts.maxSize()
+	if len(opts.AllowedTypes) == 0 {
+		opts.AllowedTypes = DefaultUploadTypes
+	}
+
+	if fh.Size > opts.MaxSize {
+		return "", NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than %d bytes", opts.MaxSize))
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	head = head[:n]
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !contains(opts.AllowedTypes, contentType) {
+		return "", NewHTTPError(http.StatusUnsupportedMediaType, "file type "+contentType+" is not allowed")
+	}
+
+	name, err := randomUploadName(contentType)
+	if err != nil {
+		return "", err
+	}
+
+	// 大小以实际读到的为准, 多读一个字节判断是否超过限制
+	lr := &io.LimitedReader{R: io.MultiReader(bytes.NewReader(head), f), N: opts.MaxSize + 1}
+	url, err := store.Save(name, lr)
+	if err != nil {
+		return "", err
+	}
+	if lr.N == 0 {
+		store.Delete(name)
+		return "", NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("file is larger than %d bytes", opts.MaxSize))
+	}
+	return url, nil
+}
+
+func randomUploadName(contentType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	ext, ok := uploadExts[contentType]
+	if !ok {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return time.Now().Format("2006/01/") + hex.EncodeToString(b) + ext, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalStore 把上传的文件保存在本地目录, 通常放在 Static 提供的 public 目录下
+type LocalStore struct {
+	Dir       string // 保存目录, 例如 public/uploads
+	URLPrefix string // 访问这个目录的 URL 前缀, 例如 /public/uploads
+}
+
+func NewLocalStore(dir, urlPrefix string) *LocalStore {
+	return &LocalStore{Dir: dir, URLPrefix: urlPrefix}
+}
+
+// Save 先写到同一目录下的临时文件, 写完之后再改名, 不会留下写了一半的文件
+func (s *LocalStore) Save(name string, r io.Reader) (string, error) {
+	file, err := s.path(name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return "", err
+	}
+
+	return path.Join(s.URLPrefix, name), nil
+}
+
+func (s *LocalStore) Delete(name string) error {
+	file, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// path 返回 name 在 Dir 中的路径, name 不能跳出 Dir
+func (s *LocalStore) path(name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if name == "" || clean != "/"+name || strings.Contains(name, "\\") {
+		return "", errors.New("upload: invalid file name " + name)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(clean[1:])), nil
+}
@@ -0,0 +1,123 @@
+package framework
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func pngBytes() []byte {
+	var b bytes.Buffer
+	png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	return b.Bytes()
+}
+
+func uploadRequest(field, filename string, content []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile(field, filename)
+	fw.Write(content)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStore(filepath.Join(dir, "uploads"), "/public/uploads")
+
+	tests := []struct {
+		field    string
+		filename string
+		content  []byte
+		opts     UploadOptions
+		code     int
+	}{
+		{"cover", "a.png", pngBytes(), UploadOptions{}, 0},
+		// 扩展名和客户端的类型都不可信, 按内容判断
+		{"cover", "evil.png", []byte("<html><script>alert(1)</script>"), UploadOptions{}, http.StatusUnsupportedMediaType},
+		{"cover", "a.txt", []byte("hello"), UploadOptions{AllowedTypes: []string{"text/plain"}}, 0},
+		{"cover", "a.png", pngBytes(), UploadOptions{MaxSize: 10}, http.StatusRequestEntityTooLarge},
+		{"other", "a.png", pngBytes(), UploadOptions{}, http.StatusBadRequest},
+	}
+
+	nameRe := regexp.MustCompile(`^/public/uploads/\d{4}/\d{2}/[0-9a-f]{32}\.(png|txt)$`)
+	for i, tt := range tests {
+		ctx := &Context{Request: uploadRequest(tt.field, tt.filename, tt.content)}
+		url, err := ctx.Upload("cover", store, tt.opts)
+
+		if tt.code != 0 {
+			if StatusCode(err) != tt.code {
+				t.Fatalf("%v: bad error: got %v, want %d", i+1, err, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: upload: %v", i+1, err)
+		}
+		if !nameRe.MatchString(url) {
+			t.Fatalf("%v: bad url: got %q", i+1, url)
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, "uploads", strings.TrimPrefix(url, "/public/uploads/")))
+		if err != nil || !bytes.Equal(b, tt.content) {
+			t.Fatalf("%v: bad file: got %q, %v", i+1, b, err)
+		}
+	}
+
+	entries, _ := filepath.Glob(filepath.Join(dir, "uploads", "*", "*", ".upload-*"))
+	if len(entries) != 0 {
+		t.Fatalf("temp files left: %v", entries)
+	}
+}
+
+func TestUploadBodySize(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/public/uploads")
+
+	// 请求体超过 MaxSize 太多时读到限制就停下, 不会整个写到临时文件里
+	r := uploadRequest("cover", "big.png", append(pngBytes(), make([]byte, 2*uploadFormOverhead)...))
+	ctx := &Context{ResponseWriter: httptest.NewRecorder(), Request: r}
+	_, err := ctx.Upload("cover", store, UploadOptions{MaxSize: 1024})
+	var tooLarge *http.MaxBytesError
+	if StatusCode(err) != http.StatusRequestEntityTooLarge || !errors.As(err, &tooLarge) {
+		t.Fatalf("bad error: got %v", err)
+	}
+
+	// FormFile 按路由的 MaxBodySize 限制
+	r = uploadRequest("cover", "a.png", pngBytes())
+	ctx = &Context{ResponseWriter: httptest.NewRecorder(), Request: r, router: &RegistorController{MaxBodySize: 16}}
+	if _, err := ctx.FormFile("cover"); StatusCode(err) != http.StatusRequestEntityTooLarge {
+		t.Fatalf("bad form file error: got %v", err)
+	}
+}
+
+func TestLocalStorePath(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/public/uploads")
+	for _, name := range []string{"", "../x.png", "a/../../x.png", "/x.png", `a\..\x.png`, "a//b.png"} {
+		if _, err := store.Save(name, strings.NewReader("x")); err == nil {
+			t.Fatalf("save %q: want error", name)
+		}
+	}
+}
+
+func TestSaveToFile(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "a", "b.png")
+	ctx := &Context{Request: uploadRequest("cover", "b.png", pngBytes())}
+	if err := ctx.SaveToFile("cover", dest); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if b, _ := os.ReadFile(dest); !bytes.Equal(b, pngBytes()) {
+		t.Fatalf("bad file: got %q", b)
+	}
+}
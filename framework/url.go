@@ -0,0 +1,206 @@
+// 命名路由和反向生成 URL
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"text/template/parse"
+)
+
+// Name 给路由命名, 之后可以通过 URLFor 生成它的 URL. 名字重复时 panic.
+func (route *Route) Name(name string) *Route {
+	rc := route.router
+	if old, ok := rc.names[name]; ok && old.routePath != route.routePath {
+		panic("router: route name " + name + " is already used by " + old.pattern)
+	}
+
+	if rc.names == nil {
+		rc.names = make(map[string]*Route)
+	}
+	if route.name != "" {
+		delete(rc.names, route.name)
+	}
+
+	route.name = name
+	rc.names[name] = route
+	return route
+}
+
+// URLFor 生成命名路由的 URL, params 是成对的参数名和参数值, 例如
+//
+//	rc.URLFor("user", "id", 42, "xxx", "abc", "page", 2) // /users/42/abc?page=2
+//
+// 路由参数会按 Route.regexp 校验, 不属于路由的参数拼接成 query string.
+func (rc *RegistorController) URLFor(name string, params ...interface{}) (string, error) {
+	route, ok := rc.names[name]
+	if !ok {
+		return "", fmt.Errorf("urlfor: no route named %q", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("urlfor %s: params must be key value pairs", name)
+	}
+
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("urlfor %s: param key %v is not a string", name, params[i])
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+
+	var path, raw strings.Builder
+	for _, seg := range route.segments {
+		if seg.kind == staticNode {
+			path.WriteString(seg.text)
+			raw.WriteString(seg.text)
+			continue
+		}
+
+		value, ok := values[seg.text]
+		if !ok {
+			return "", fmt.Errorf("urlfor %s: missing param %q for %s", name, seg.text, route.pattern)
+		}
+		delete(values, seg.text)
+
+		if seg.kind == paramNode {
+			if value == "" || strings.Contains(value, "/") {
+				return "", fmt.Errorf("urlfor %s: bad value %q for param %q", name, value, seg.text)
+			}
+			path.WriteString(url.PathEscape(value))
+		} else {
+			path.WriteString((&url.URL{Path: value}).EscapedPath())
+		}
+		raw.WriteString(value)
+	}
+
+	if !route.regexp.MatchString(raw.String()) {
+		return "", fmt.Errorf("urlfor %s: params do not match %s", name, route.pattern)
+	}
+
+	if len(values) > 0 {
+		query := url.Values{}
+		for key, value := range values {
+			query.Set(key, value)
+		}
+		path.WriteString("?" + query.Encode())
+	}
+
+	return path.String(), nil
+}
+
+// MustURLFor 同 URLFor, 出错时 panic, 适合在启动时生成固定的链接
+func (rc *RegistorController) MustURLFor(name string, params ...interface{}) string {
+	u, err := rc.URLFor(name, params...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// FuncMap 返回模板函数 urlfor, 用法 {{urlfor "user" "id" .ID}}
+func (rc *RegistorController) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"urlfor": rc.URLFor,
+	}
+}
+
+// CheckURLFor 检查模板中所有 urlfor 调用: 路由名必须存在,
+// 参数名都是字面量时还要给全路由参数. 启动时调用可以提前发现坏链接.
+func (rc *RegistorController) CheckURLFor(t *template.Template) error {
+	var errs []string
+	for _, tpl := range t.Templates() {
+		if tpl.Tree == nil || tpl.Tree.Root == nil {
+			continue
+		}
+
+		walkCommands(tpl.Tree.Root, func(cmd *parse.CommandNode) {
+			if err := rc.checkURLForCommand(cmd); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", tpl.Name(), err))
+			}
+		})
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func (rc *RegistorController) checkURLForCommand(cmd *parse.CommandNode) error {
+	if len(cmd.Args) < 2 {
+		return nil
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "urlfor" {
+		return nil
+	}
+
+	nameNode, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return nil
+	}
+
+	route, ok := rc.names[nameNode.Text]
+	if !ok {
+		return fmt.Errorf("urlfor: no route named %q", nameNode.Text)
+	}
+
+	keys := make(map[string]bool)
+	args := cmd.Args[2:]
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(*parse.StringNode)
+		if !ok {
+			return nil
+		}
+		keys[key.Text] = true
+	}
+
+	for _, param := range route.params {
+		if !keys[param] {
+			return fmt.Errorf("urlfor %s: missing param %q for %s", nameNode.Text, param, route.pattern)
+		}
+	}
+	return nil
+}
+
+// walkCommands 遍历模板语法树中的所有命令, 包括管道和括号里的命令
+func walkCommands(n parse.Node, fn func(*parse.CommandNode)) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n != nil {
+			for _, c := range n.Nodes {
+				walkCommands(c, fn)
+			}
+		}
+	case *parse.ActionNode:
+		walkCommands(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n != nil {
+			for _, c := range n.Cmds {
+				walkCommands(c, fn)
+			}
+		}
+	case *parse.CommandNode:
+		fn(n)
+		for _, arg := range n.Args {
+			walkCommands(arg, fn)
+		}
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, fn)
+	case *parse.TemplateNode:
+		walkCommands(n.Pipe, fn)
+	}
+}
+
+func walkBranch(n *parse.BranchNode, fn func(*parse.CommandNode)) {
+	walkCommands(n.Pipe, fn)
+	walkCommands(n.List, fn)
+	walkCommands(n.ElseList, fn)
+}
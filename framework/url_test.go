@@ -0,0 +1,82 @@
+package framework
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+func TestURLFor(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Add("/users/:id([0-9]+)/:xxx(\\w+)", &getController{}).Name("user")
+	rc.Get("/static/*filepath", func(*Context) {}).Name("static")
+	rc.Get("/", func(*Context) {}).Name("home")
+	rc.Group("/admin", func(g *Group) {
+		g.Get("/posts/:id", func(*Context) {}).Name("admin.post")
+	})
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		url    string
+		err    string
+	}{
+		{"home", nil, "/", ""},
+		{"user", []interface{}{"id", 42, "xxx", "abc"}, "/users/42/abc", ""},
+		{"user", []interface{}{"id", 42, "xxx", "abc", "page", 2, "q", "a b"}, "/users/42/abc?page=2&q=a+b", ""},
+		{"user", []interface{}{"id", "x", "xxx", "abc"}, "", "do not match"},
+		{"user", []interface{}{"id", 42}, "", "missing param"},
+		{"user", []interface{}{"id"}, "", "key value pairs"},
+		{"static", []interface{}{"filepath", "css/app.css"}, "/static/css/app.css", ""},
+		{"admin.post", []interface{}{"id", "hello world"}, "/admin/posts/hello%20world", ""},
+		{"admin.post", []interface{}{"id", "a/b"}, "", "bad value"},
+		{"missing", nil, "", "no route named"},
+	}
+	for i, v := range tests {
+		u, err := rc.URLFor(v.name, v.params...)
+		if v.err != "" {
+			if err == nil || !strings.Contains(err.Error(), v.err) {
+				t.Fatalf("%v: expected error %q, got %v", i+1, v.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", i+1, err)
+		}
+		if u != v.url {
+			t.Fatalf("%v: bad url: got %q, want %q", i+1, u, v.url)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a duplicate name panic")
+		}
+	}()
+	rc.Get("/other", func(*Context) {}).Name("home")
+}
+
+func TestURLForTemplate(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Get("/users/:id", func(*Context) {}).Name("user")
+
+	tpl := template.Must(template.New("index").Funcs(rc.FuncMap()).Parse(
+		`<a href="{{urlfor "user" "id" .}}">user</a>`))
+	var out strings.Builder
+	if err := tpl.Execute(&out, 7); err != nil {
+		t.Fatal("execute template fail: ", err)
+	}
+	if out.String() != `<a href="/users/7">user</a>` {
+		t.Fatalf("bad output: %q", out.String())
+	}
+	if err := rc.CheckURLFor(tpl); err != nil {
+		t.Fatal("unexpected check error: ", err)
+	}
+
+	broken := template.Must(template.New("broken").Funcs(rc.FuncMap()).Parse(
+		`{{if .}}{{urlfor "users" "id" 1}}{{else}}{{with $x := urlfor "user" "page" 1}}{{$x}}{{end}}{{end}}`))
+	err := rc.CheckURLFor(broken)
+	if err == nil || !strings.Contains(err.Error(), `no route named "users"`) || !strings.Contains(err.Error(), `missing param "id"`) {
+		t.Fatalf("expected broken links to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+// 模板引擎
+// 启动时一次性加载 views 目录下的所有模板, 模板名是相对 views 目录的路径, 例如 MainController/Get.html,
+// 所有模板在同一个集合中, 可以直接用 {{template "partials/header.html" .}} 引用其他模板.
+package framework
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ViewEngine struct {
+	dir   string
+	exts  []string
+	funcs template.FuncMap
+
+	// DevMode 开发模式, 每次渲染前检查模板文件的修改时间, 有变化就重新加载
+	DevMode bool
+
+	mu        sync.RWMutex
+	templates *template.Template
+	modTimes  map[string]time.Time             // file: mod time
+	checks    []func(*template.Template) error // Check 添加的检查
+}
+
+// NewViewEngine 加载 dir 下扩展名为 .html 和 .tpl 的模板, funcs 是模板中可以使用的函数
+func NewViewEngine(dir string, funcs template.FuncMap) (*ViewEngine, error) {
+	ve := &ViewEngine{
+		dir:   dir,
+		exts:  []string{".html", ".tpl"},
+		funcs: funcs,
+	}
+
+	if err := ve.Load(); err != nil {
+		return nil, err
+	}
+	return ve, nil
+}
+
+// Load 重新加载所有模板, 解析失败时保留原来的模板
+func (ve *ViewEngine) Load() error {
+	modTimes, err := ve.scan()
+	if err != nil {
+		return err
+	}
+
+	templates := template.New("").Funcs(ve.funcs)
+	for file := range modTimes {
+		b, err := os.ReadFile(filepath.Join(ve.dir, file))
+		if err != nil {
+			return err
+		}
+
+		if _, err := templates.New(file).Parse(string(b)); err != nil {
+			return err
+		}
+	}
+
+	ve.mu.RLock()
+	checks := ve.checks
+	ve.mu.RUnlock()
+	for _, check := range checks {
+		if err := check(templates); err != nil {
+			return err
+		}
+	}
+
+	ve.mu.Lock()
+	ve.templates = templates
+	ve.modTimes = modTimes
+	ve.mu.Unlock()
+
+	return nil
+}
+
+// Check 添加模板检查, 例如 RegistorController.CheckURLFor. 立即检查已经加载的模板,
+// 之后每次 Load 都先检查, 出错时保留原来的模板.
+func (ve *ViewEngine) Check(fn func(*template.Template) error) error {
+	ve.mu.Lock()
+	ve.checks = append(ve.checks, fn)
+	templates := ve.templates
+	ve.mu.Unlock()
+
+	return fn(templates)
+}
+
+// scan 找出所有模板文件和它们的修改时间, 文件名使用 / 分隔的相对路径
+func (ve *ViewEngine) scan() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	err := filepath.Walk(ve.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !ve.isTemplate(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(ve.dir, path)
+		if err != nil {
+			return err
+		}
+		modTimes[filepath.ToSlash(rel)] = info.ModTime()
+		return nil
+	})
+
+	return modTimes, err
+}
+
+func (ve *ViewEngine) isTemplate(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range ve.exts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// changed 判断模板文件是否有增删改
+func (ve *ViewEngine) changed() bool {
+	modTimes, err := ve.scan()
+	if err != nil {
+		return true
+	}
+
+	ve.mu.RLock()
+	defer ve.mu.RUnlock()
+
+	if len(modTimes) != len(ve.modTimes) {
+		return true
+	}
+	for file, t := range modTimes {
+		if old, ok := ve.modTimes[file]; !ok || !old.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ve *ViewEngine) lookup() (*template.Template, error) {
+	if ve.DevMode && ve.changed() {
+		if err := ve.Load(); err != nil {
+			return nil, err
+		}
+	}
+
+	ve.mu.RLock()
+	defer ve.mu.RUnlock()
+	return ve.templates, nil
+}
+
+// Exists 判断模板是否存在
+func (ve *ViewEngine) Exists(name string) bool {
+	templates, err := ve.lookup()
+	return err == nil && templates.Lookup(name) != nil
+}
+
+// Render 渲染模板 name
+func (ve *ViewEngine) Render(w io.Writer, name string, data interface{}) error {
+	templates, err := ve.lookup()
+	if err != nil {
+		return err
+	}
+
+	if templates.Lookup(name) == nil {
+		return fmt.Errorf("view: template %q not found in %s", name, ve.dir)
+	}
+	return templates.ExecuteTemplate(w, name, data)
+}
+
+// RenderLayout 渲染模板 name, 结果作为 LayoutContent 依次套进 layouts 中, layouts[0] 在最外层.
+// sections 是 name: 模板 的映射, 每个模板渲染之后以 name 放进 data, 布局中用 {{.Scripts}} 这样引用.
+// 整个页面先渲染到缓冲区, 出错时不会输出半个页面.
+func (ve *ViewEngine) RenderLayout(w io.Writer, name string, layouts []string, sections map[string]string, data map[interface{}]interface{}) error {
+	var buf bytes.Buffer
+	for section, tpl := range sections {
+		if err := ve.Render(&buf, tpl, data); err != nil {
+			return err
+		}
+		data[section] = template.HTML(buf.String())
+		buf.Reset()
+	}
+
+	if err := ve.Render(&buf, name, data); err != nil {
+		return err
+	}
+
+	for i := len(layouts) - 1; i >= 0; i-- {
+		data["LayoutContent"] = template.HTML(buf.String())
+		buf.Reset()
+		if err := ve.Render(&buf, layouts[i], data); err != nil {
+			return err
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// templateName 返回控制器方法默认的模板名, 例如 MainController/Get.html
+func templateName(childName, methodName, ext string) string {
+	return childName + "/" + methodName + "." + strings.TrimPrefix(ext, ".")
+}
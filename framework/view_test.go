@@ -0,0 +1,134 @@
+package framework
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeViews(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type viewController struct {
+	Controller
+}
+
+func (c *viewController) Get() {
+	c.Data["Title"] = "home"
+	c.Layout = []string{"layouts/base.html", "layouts/admin.html"}
+	c.LayoutSections["Scripts"] = "partials/scripts.html"
+}
+
+func (c *viewController) Post() {
+	c.TplNames = "missing.html"
+}
+
+func (c *viewController) Put() {}
+
+func TestViewEngine(t *testing.T) {
+	dir := t.TempDir()
+	writeViews(t, dir, map[string]string{
+		"layouts/base.html":       `<html>{{.LayoutContent}}{{.Scripts}}</html>`,
+		"layouts/admin.html":      `<main>{{template "partials/nav.html" .}}{{.LayoutContent}}</main>`,
+		"partials/nav.html":       `<nav>{{.Title}}</nav>`,
+		"partials/scripts.html":   `<script src="{{.Title}}.js"></script>`,
+		"viewController/Get.html": `<h1>{{.Title}}</h1>`,
+		"ignored.txt":             `{{`,
+	})
+
+	views, err := NewViewEngine(dir, nil)
+	if err != nil {
+		t.Fatal("load views fail: ", err)
+	}
+
+	rc := &RegistorController{Views: views}
+	rc.Add("/", &viewController{})
+
+	w := serve(rc, "GET", "/")
+	want := `<html><main><nav>home</nav><h1>home</h1></main><script src="home.js"></script></html>`
+	if w.Body.String() != want {
+		t.Fatalf("bad page:\ngot  %s\nwant %s", w.Body.String(), want)
+	}
+	if w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("bad content type: %q", w.Header().Get("Content-Type"))
+	}
+
+	if w := serve(rc, "POST", "/"); w.Code != 500 {
+		t.Fatalf("explicit missing template should fail: got %v", w.Code)
+	}
+	if w := serve(rc, "PUT", "/"); w.Code != 200 || w.Body.Len() != 0 {
+		t.Fatalf("missing conventional template should render nothing: %v %q", w.Code, w.Body.String())
+	}
+}
+
+func TestViewEngineReload(t *testing.T) {
+	dir := t.TempDir()
+	writeViews(t, dir, map[string]string{"index.html": `v1`})
+
+	views, err := NewViewEngine(dir, nil)
+	if err != nil {
+		t.Fatal("load views fail: ", err)
+	}
+
+	render := func() string {
+		var out strings.Builder
+		if err := views.Render(&out, "index.html", nil); err != nil {
+			t.Fatal("render fail: ", err)
+		}
+		return out.String()
+	}
+
+	writeViews(t, dir, map[string]string{"index.html": `v2`})
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "index.html"), future, future)
+
+	if got := render(); got != "v1" {
+		t.Fatalf("templates should be cached: got %q", got)
+	}
+
+	views.DevMode = true
+	if got := render(); got != "v2" {
+		t.Fatalf("templates should be reloaded in dev mode: got %q", got)
+	}
+}
+
+func TestViewEngineCheck(t *testing.T) {
+	rc := &RegistorController{}
+	rc.Get("/users/:id", func(*Context) {}).Name("user")
+
+	dir := t.TempDir()
+	writeViews(t, dir, map[string]string{"index.html": `{{urlfor "users" "id" 1}}`})
+	views, err := NewViewEngine(dir, rc.FuncMap())
+	if err != nil {
+		t.Fatal("load views fail: ", err)
+	}
+	if err := views.Check(rc.CheckURLFor); err == nil || !strings.Contains(err.Error(), `no route named "users"`) {
+		t.Fatalf("broken link not reported: %v", err)
+	}
+
+	writeViews(t, dir, map[string]string{"index.html": `{{urlfor "user" "id" 1}}`})
+	if err := views.Load(); err != nil {
+		t.Fatal("load fixed views fail: ", err)
+	}
+
+	// 检查失败时保留原来的模板
+	writeViews(t, dir, map[string]string{"index.html": `{{urlfor "user"}}`})
+	if err := views.Load(); err == nil || !strings.Contains(err.Error(), `missing param "id"`) {
+		t.Fatalf("broken link not reported on load: %v", err)
+	}
+	var out strings.Builder
+	if err := views.Render(&out, "index.html", nil); err != nil || out.String() != "/users/1" {
+		t.Fatalf("bad page after failed load: got %q, %v", out.String(), err)
+	}
+}
@@ -0,0 +1,294 @@
+// 简单的 YAML 编码器, 只用于输出响应, 支持基本类型, 切片, map 和结构体.
+// 结构体字段名依次取 yaml tag, json tag, 小写的字段名, tag 为 "-" 的字段忽略.
+package framework
+
+import (
+	"bufio"
+	"encoding"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// YAMLEncoder 把值以 YAML 格式写到输出流中
+type YAMLEncoder struct {
+	w        *bufio.Writer
+	visiting map[yamlRef]bool // 正在编码的指针, map 和切片, 用来发现循环引用
+}
+
+// yamlRef 是引用类型的值的标识, 同一个地址上的不同类型 (例如结构体和它的第一个字段) 不算同一个值
+type yamlRef struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+func NewYAMLEncoder(w io.Writer) *YAMLEncoder {
+	return &YAMLEncoder{w: bufio.NewWriter(w)}
+}
+
+// Encode 写出一个 YAML 文档
+func (e *YAMLEncoder) Encode(v interface{}) error {
+	if err := e.encode(reflect.ValueOf(v), 0, posDocument); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// yamlPos 是值在输出中的位置, 决定它前面是否需要换行
+type yamlPos int
+
+const (
+	posDocument yamlPos = iota // 文档开头
+	posValue                   // 紧跟在 "key:" 之后
+	posItem                    // 紧跟在 "-" 之后, map 的第一个键可以和 "-" 写在同一行
+)
+
+// encode 写出 v, indent 是当前的缩进层级
+func (e *YAMLEncoder) encode(v reflect.Value, indent int, pos yamlPos) error {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			break
+		}
+		if v.Type().Implements(textMarshalerType) {
+			break
+		}
+		if v.Kind() == reflect.Ptr {
+			leave, err := e.enter(v)
+			if err != nil {
+				return err
+			}
+			defer leave()
+		}
+		v = v.Elem()
+	}
+
+	if !v.IsValid() || ((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		return e.scalar("null", pos)
+	}
+
+	if v.Type() == timeType {
+		return e.scalar(v.Interface().(time.Time).Format(time.RFC3339Nano), pos)
+	}
+
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		return e.scalar(yamlString(string(b)), pos)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return e.scalar(strconv.FormatBool(v.Bool()), pos)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.scalar(strconv.FormatInt(v.Int(), 10), pos)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.scalar(strconv.FormatUint(v.Uint(), 10), pos)
+	case reflect.Float32, reflect.Float64:
+		return e.scalar(yamlFloat(v.Float()), pos)
+	case reflect.String:
+		return e.scalar(yamlString(v.String()), pos)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return e.scalar(yamlString(string(v.Bytes())), pos)
+		}
+		if v.Kind() == reflect.Slice {
+			leave, err := e.enter(v)
+			if err != nil {
+				return err
+			}
+			defer leave()
+		}
+		return e.sequence(v, indent, pos)
+	case reflect.Map:
+		leave, err := e.enter(v)
+		if err != nil {
+			return err
+		}
+		defer leave()
+
+		keys := v.MapKeys()
+		items := make([]yamlItem, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, yamlItem{key: fmt.Sprint(k.Interface()), value: v.MapIndex(k)})
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+		return e.mapping(items, indent, pos)
+	case reflect.Struct:
+		return e.mapping(structItems(v), indent, pos)
+	}
+
+	return fmt.Errorf("yaml: unsupported type %s", v.Type())
+}
+
+// enter 记录正在编码指针, map 或切片 v, v 已经在编码中时说明有循环引用, 返回错误.
+// 编码完 v 之后调用返回的 leave, 同一个值在不同的地方出现多次不算循环.
+func (e *YAMLEncoder) enter(v reflect.Value) (leave func(), err error) {
+	ref := yamlRef{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		ref.len = v.Len()
+	}
+	if e.visiting == nil {
+		e.visiting = make(map[yamlRef]bool)
+	}
+	if e.visiting[ref] {
+		return nil, fmt.Errorf("yaml: encountered a cycle via %s", v.Type())
+	}
+
+	e.visiting[ref] = true
+	return func() { delete(e.visiting, ref) }, nil
+}
+
+type yamlItem struct {
+	key   string
+	value reflect.Value
+}
+
+func (e *YAMLEncoder) scalar(s string, pos yamlPos) error {
+	if pos != posDocument {
+		e.w.WriteByte(' ')
+	}
+	e.w.WriteString(s)
+	e.w.WriteByte('\n')
+	return nil
+}
+
+func (e *YAMLEncoder) sequence(v reflect.Value, indent int, pos yamlPos) error {
+	if v.Len() == 0 {
+		return e.scalar("[]", pos)
+	}
+	if pos != posDocument {
+		e.w.WriteByte('\n')
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		e.w.WriteString(strings.Repeat("  ", indent))
+		e.w.WriteString("-")
+		if err := e.encode(v.Index(i), indent+1, posItem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *YAMLEncoder) mapping(items []yamlItem, indent int, pos yamlPos) error {
+	if len(items) == 0 {
+		return e.scalar("{}", pos)
+	}
+	if pos == posValue {
+		e.w.WriteByte('\n')
+	}
+
+	for i, item := range items {
+		if i == 0 && pos == posItem {
+			e.w.WriteByte(' ')
+		} else {
+			e.w.WriteString(strings.Repeat("  ", indent))
+		}
+		e.w.WriteString(yamlString(item.key))
+		e.w.WriteString(":")
+		if err := e.encode(item.value, indent+1, posValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// structItems 返回结构体需要输出的字段, 内嵌结构体的字段提升到外层
+func structItems(v reflect.Value) []yamlItem {
+	t := v.Type()
+	items := make([]yamlItem, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		name, omitempty := fieldName(f)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if f.Anonymous && name == "" && fv.Kind() == reflect.Struct {
+			items = append(items, structItems(fv)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if omitempty && fv.IsZero() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		items = append(items, yamlItem{key: name, value: fv})
+	}
+	return items
+}
+
+func fieldName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("yaml")
+	if !ok {
+		tag = f.Tag.Get("json")
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, strings.Contains(opts, "omitempty")
+}
+
+func yamlFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return ".nan"
+	case math.IsInf(f, 1):
+		return ".inf"
+	case math.IsInf(f, -1):
+		return "-.inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// yamlString 需要时给字符串加引号, 避免被解析成其他类型或者破坏结构
+func yamlString(s string) string {
+	if s == "" {
+		return `""`
+	}
+
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return strconv.Quote(s)
+	}
+
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@` \t") ||
+		strings.ContainsAny(s, "\n\r\t\"\\") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.HasSuffix(s, " ") || strings.HasSuffix(s, ":") {
+		return strconv.Quote(s)
+	}
+
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+
+	return s
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/allbuleyu/blog/framework"
 	"github.com/allbuleyu/blog/framework/session"
 	"html/template"
 	"log"
 	"net/http"
+	"os"
+	"time"
 )
 
 type MainController struct {
@@ -20,21 +25,15 @@ func (c *MainController) Get() {
 		panic(err)
 	}
 
-
-	c.Tpl,err = template.ParseFiles("public/index.html")
-	if err != nil {
-		panic(err)
-	}
-	c.TplNames = c.Tpl.Name()
+	c.Layout = []string{"layout.html"}
 
 	c.Data["Name"] = "hyl"
 	c.Data["Email"] = "hyl.gmail.com"
 	c.Data["User"] = c.Ctx.Params
 
-	mgr := framework.NewSessionMgr("GoWebSessionId", 10)
-	mgr.StartSession(c.Ctx.ResponseWriter, c.Ctx.Request)
+	sessions.StartSession(c.Ctx.ResponseWriter, c.Ctx.Request)
 
-	cookieStore := session.NewCookieStore([]byte("new-hash-key"))
+	cookieStore := session.NewCookieStore(cookieHashKey)
 	cookieStore.Options.MaxAge=60
 	sess, err := cookieStore.New(c.Ctx.Request, "hylsdfsdfsdfsd")
 
@@ -53,23 +52,95 @@ func (c *MainController) Get() {
 	fmt.Println(name)
 }
 
+// sessions 由 App 创建, 关闭时停止 GC
+var sessions *framework.SessionMgr
+
+// cookieHashKey 来自配置的 session_hash_key, 可以是 blogctl config encrypt 加密过的值
+var cookieHashKey []byte
+
+// sessionHashKey 读取 session_hash_key, 解密失败时返回错误.
+// 只有开发模式 (没有配置文件时也算) 允许不配置, 使用随机的密钥, 重启之后原来的 cookie 失效.
+func sessionHashKey(cfg *framework.Config) ([]byte, error) {
+	key, err := cfg.Secret("session_hash_key")
+	if err == nil && key != "" {
+		return []byte(key), nil
+	}
+	if err != nil && cfg.Source("session_hash_key") != "" {
+		return nil, err
+	}
+	if mode := cfg.RunMode(); mode != "" && mode != "dev" {
+		return nil, errors.New("session_hash_key is not set, encrypt one with blogctl config encrypt")
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	log.Println("session_hash_key is not set, using a random key")
+	return random, nil
+}
+
 func init() {
 	gob.Register([]interface{}{})
 }
 
 func main() {
-	routes := framework.RegistorController{}
-	routes.Add("/", &MainController{})
-	routes.Add("/users/:id([0-9]+)/:xxx(\\w+)", &MainController{})
+	// 配置文件修改之后自动重新加载
+	cfg, err := framework.WatchConfig("conf/app.conf", 2*time.Second)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatal("load config: ", err)
+	}
+
+	app := framework.NewApp(cfg)
+	if cfg != nil {
+		app.OnShutdown(func(ctx context.Context) error {
+			cfg.StopWatch()
+			return nil
+		})
+	}
+	sessions = app.Sessions
+	cookieHashKey, err = sessionHashKey(app.Config)
+	if err != nil {
+		log.Fatal("load session key: ", err)
+	}
 
+	routes := app.Router
+	routes.Add("/", &MainController{}).Name("home")
+	routes.Add("/users/:id([0-9]+)/:xxx(\\w+)", &MainController{}).Name("user")
+	// blogctl assets 生成的清单, 没有时启动时计算. 文件改过之后清单就过期了, 需要重新生成
+	assets, err := framework.LoadAssetManifest("assets.json")
+	if err == nil {
+		if err = assets.Verify(os.DirFS("public")); err != nil {
+			log.Fatal("load assets: ", err, ", run blogctl assets again or remove assets.json")
+		}
+	} else if os.IsNotExist(err) {
+		assets, err = framework.BuildAssetManifest(os.DirFS("public"), "/public")
+	}
+	if err != nil {
+		log.Fatal("load assets: ", err)
+	}
+	routes.Static("/public", "public", framework.StaticOptions{Manifest: assets})
 
+	funcs := routes.FuncMap()
+	for name, fn := range assets.FuncMap() {
+		funcs[name] = fn
+	}
 
+	views, err := framework.NewViewEngine("views", funcs)
+	if err != nil {
+		log.Fatal("load views: ", err)
+	}
+	// 启动时检查模板中的 urlfor, 坏链接直接报错
+	if err := views.Check(routes.CheckURLFor); err != nil {
+		log.Fatal("check views: ", err)
+	}
+	routes.Views = views
 
 	//http.HandleFunc("/", hh)
-	err := http.ListenAndServe(":8080", &routes)
+	err = app.Run()
 
 	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+		log.Fatal("Run: ", err)
 
 	}
 